@@ -0,0 +1,239 @@
+// Package analyze measures the similarity metric over a directory of
+// captures, to pick a dedup threshold from data rather than by guesswork.
+package analyze
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"screenshot-capture/capture"
+	"screenshot-capture/pages"
+	"screenshot-capture/similarity"
+)
+
+// floor stands in for a zero diff on the log scale; it is below the
+// smallest non-zero ratio of captures up to 10000x10000 pixels.
+const floor = 1e-6
+
+// Pair is the difference between two captures.
+type Pair struct {
+	A, B    string
+	Diff    float64
+	Outlier bool // Far from the other pairs on its side of the threshold
+}
+
+// Load samples every capture in dir, in page order.
+func Load(dir string) ([]string, []similarity.Samples, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && capture.IsImageFile(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	pages.Sort(names)
+
+	samples := make([]similarity.Samples, len(names))
+	for i, name := range names {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return nil, nil, err
+		}
+		img, err := capture.Decode(file)
+		file.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode %s: %w", name, err)
+		}
+		samples[i] = similarity.Sample(img)
+	}
+	return names, samples, nil
+}
+
+// Consecutive compares every capture with the next one.
+func Consecutive(names []string, samples []similarity.Samples) []Pair {
+	var pairs []Pair
+	for i := 1; i < len(names); i++ {
+		pairs = append(pairs, Pair{A: names[i-1], B: names[i], Diff: samples[i-1].Diff(samples[i])})
+	}
+	return pairs
+}
+
+// All compares every capture with every other one.
+func All(names []string, samples []similarity.Samples) []Pair {
+	var pairs []Pair
+	for i := range names {
+		for j := i + 1; j < len(names); j++ {
+			pairs = append(pairs, Pair{A: names[i], B: names[j], Diff: samples[i].Diff(samples[j])})
+		}
+	}
+	return pairs
+}
+
+// Recommendation is a suggested threshold.
+type Recommendation struct {
+	Threshold float64
+	// Separation is the ratio between the smallest diff above the
+	// threshold and the largest below it; under 3 the data has no clear
+	// gap and Threshold is only a safe guess.
+	Separation float64
+	Below      int // Pairs that would count as re-captures
+}
+
+// Recommend splits the diffs into re-captures and page turns where their
+// log-scale distributions separate best (Otsu's method). The threshold goes
+// at half the smallest page-turn diff, tolerating as much re-capture noise
+// as possible, or at the geometric middle of the gap if that is narrower.
+// When there is no clear gap, all pairs are assumed to be page turns.
+func Recommend(pairs []Pair) (Recommendation, bool) {
+	if len(pairs) == 0 {
+		return Recommendation{}, false
+	}
+
+	logs := make([]float64, len(pairs))
+	for i, p := range pairs {
+		logs[i] = logDiff(p.Diff)
+	}
+	sort.Float64s(logs)
+
+	// Prefix sums for the class means
+	sum := make([]float64, len(logs)+1)
+	for i, v := range logs {
+		sum[i+1] = sum[i] + v
+	}
+
+	best, bestScore := 0, -1.0
+	n := float64(len(logs))
+	for k := 1; k < len(logs); k++ {
+		if logs[k] == logs[k-1] {
+			continue
+		}
+		w0, w1 := float64(k)/n, float64(len(logs)-k)/n
+		m0, m1 := sum[k]/float64(k), (sum[len(logs)]-sum[k])/float64(len(logs)-k)
+		if score := w0 * w1 * (m1 - m0) * (m1 - m0); score > bestScore {
+			best, bestScore = k, score
+		}
+	}
+
+	if best > 0 {
+		lower, upper := math.Pow(10, logs[best-1]), math.Pow(10, logs[best])
+		r := Recommendation{Threshold: upper / 2, Separation: upper / lower, Below: best}
+		if r.Threshold <= lower {
+			r.Threshold = math.Sqrt(lower * upper)
+		}
+		if r.Separation >= 3 {
+			return r, true
+		}
+	}
+
+	minDiff := math.Pow(10, logs[0])
+	return Recommendation{Threshold: minDiff / 2, Separation: 1}, true
+}
+
+// MarkOutliers flags pairs far from the median of their side of threshold,
+// measured in robust standard deviations on the log scale: suspicious
+// near-duplicates among page turns, or re-captures that changed a lot.
+func MarkOutliers(pairs []Pair, threshold float64) int {
+	var below, above []float64
+	for _, p := range pairs {
+		if p.Diff < threshold {
+			below = append(below, logDiff(p.Diff))
+		} else {
+			above = append(above, logDiff(p.Diff))
+		}
+	}
+	medBelow, spreadBelow := robustSpread(below)
+	medAbove, spreadAbove := robustSpread(above)
+
+	count := 0
+	for i := range pairs {
+		med, spread := medAbove, spreadAbove
+		if pairs[i].Diff < threshold {
+			med, spread = medBelow, spreadBelow
+		}
+		pairs[i].Outlier = math.Abs(logDiff(pairs[i].Diff)-med) > 3.5*spread
+		if pairs[i].Outlier {
+			count++
+		}
+	}
+	return count
+}
+
+// robustSpread returns the median and the scaled median absolute deviation,
+// floored so tight clusters don't flag every pair.
+func robustSpread(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	med := median(values)
+	dev := make([]float64, len(values))
+	for i, v := range values {
+		dev[i] = math.Abs(v - med)
+	}
+	return med, math.Max(1.4826*median(dev), 0.1)
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func logDiff(d float64) float64 {
+	return math.Log10(math.Max(d, floor))
+}
+
+// Bin is one histogram bucket, holding diffs in [Min, Max).
+type Bin struct {
+	Min, Max float64
+	Count    int
+}
+
+// Histogram buckets the diffs on a log scale, at 1, 2 and 5 of every
+// decade, with a separate bucket for identical captures.
+func Histogram(pairs []Pair) []Bin {
+	edges := []float64{0}
+	for decade := floor; decade < 1; decade *= 10 {
+		edges = append(edges, decade, 2*decade, 5*decade)
+	}
+	edges = append(edges, math.Inf(1))
+
+	bins := make([]Bin, len(edges)-1)
+	for i := range bins {
+		bins[i] = Bin{Min: edges[i], Max: edges[i+1]}
+	}
+
+	for _, p := range pairs {
+		for i := range bins {
+			if p.Diff < bins[i].Max {
+				bins[i].Count++
+				break
+			}
+		}
+	}
+	return bins
+}
+
+// WriteCSV writes one row per pair.
+func WriteCSV(w io.Writer, pairs []Pair) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"a", "b", "diff", "outlier"})
+	for _, p := range pairs {
+		out.Write([]string{p.A, p.B, strconv.FormatFloat(p.Diff, 'f', 6, 64), strconv.FormatBool(p.Outlier)})
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,122 @@
+package analyze
+
+import (
+	"bytes"
+	"testing"
+)
+
+func pairsOf(diffs ...float64) []Pair {
+	pairs := make([]Pair, len(diffs))
+	for i, d := range diffs {
+		pairs[i] = Pair{A: "a", B: "b", Diff: d}
+	}
+	return pairs
+}
+
+func TestRecommend(t *testing.T) {
+	tests := []struct {
+		name      string
+		diffs     []float64
+		threshold float64
+		below     int
+		clear     bool // Separation of at least 3
+	}{
+		{
+			name:      "re-captures and page turns",
+			diffs:     []float64{0.001, 0.002, 0.003, 0.08, 0.1, 0.12, 0.09, 0.11},
+			threshold: 0.04, // Half the smallest page turn
+			below:     3,
+			clear:     true,
+		},
+		{
+			name:      "identical re-captures",
+			diffs:     []float64{0, 0, 0.1, 0.12, 0.15},
+			threshold: 0.05,
+			below:     2,
+			clear:     true,
+		},
+		{
+			name:      "narrow gap",
+			diffs:     []float64{0.01, 0.012, 0.011, 0.04, 0.05, 0.045},
+			threshold: 0.02, // Half of 0.04 is above 0.012
+			below:     3,
+			clear:     true,
+		},
+		{
+			name:      "only page turns",
+			diffs:     []float64{0.08, 0.1, 0.12, 0.09, 0.11},
+			threshold: 0.04, // Half the smallest diff
+			below:     0,
+		},
+	}
+	for _, tt := range tests {
+		rec, ok := Recommend(pairsOf(tt.diffs...))
+		if !ok {
+			t.Errorf("%s: no recommendation", tt.name)
+			continue
+		}
+		if diff := rec.Threshold - tt.threshold; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("%s: threshold = %v, want %v", tt.name, rec.Threshold, tt.threshold)
+		}
+		if rec.Below != tt.below || (rec.Separation >= 3) != tt.clear {
+			t.Errorf("%s: below = %d, separation = %v, want %d below and clear gap %v", tt.name, rec.Below, rec.Separation, tt.below, tt.clear)
+		}
+	}
+
+	if _, ok := Recommend(nil); ok {
+		t.Error("Recommend(nil) made a recommendation")
+	}
+}
+
+func TestMarkOutliers(t *testing.T) {
+	pairs := pairsOf(0.001, 0.0012, 0.0011, 0.1, 0.11, 0.12, 0.1, 0.0015)
+	// A page turn that barely changed anything: a suspicious near-duplicate
+	pairs = append(pairs, Pair{A: "x", B: "y", Diff: 0.012})
+
+	if n := MarkOutliers(pairs, 0.05); n != 1 {
+		t.Errorf("MarkOutliers flagged %d pairs, want 1", n)
+	}
+	for _, p := range pairs {
+		if p.Outlier != (p.A == "x") {
+			t.Errorf("pair with diff %v: outlier = %v", p.Diff, p.Outlier)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	pairs := pairsOf(0, 0, 0.0015, 0.003, 0.1, 0.12, 0.6, 1)
+	bins := Histogram(pairs)
+
+	total := 0
+	for i, bin := range bins {
+		total += bin.Count
+		if i > 0 && bin.Min != bins[i-1].Max {
+			t.Errorf("bin %d starts at %v, previous ends at %v", i, bin.Min, bins[i-1].Max)
+		}
+	}
+	if total != len(pairs) {
+		t.Errorf("histogram holds %d pairs, want %d", total, len(pairs))
+	}
+
+	counts := map[float64]int{}
+	for _, bin := range bins {
+		counts[bin.Min] = bin.Count
+	}
+	for min, want := range map[float64]int{0: 2, 0.001: 1, 0.002: 1, 0.1: 2, 0.5: 2} {
+		if got := counts[min]; got != want {
+			t.Errorf("bin from %v holds %d pairs, want %d", min, got, want)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	pairs := []Pair{{A: "kindle_001.png", B: "kindle_002.png", Diff: 0.125, Outlier: true}}
+	if err := WriteCSV(&buf, pairs); err != nil {
+		t.Fatal(err)
+	}
+	want := "a,b,diff,outlier\nkindle_001.png,kindle_002.png,0.125000,true\n"
+	if got := buf.String(); got != want {
+		t.Errorf("WriteCSV wrote %q, want %q", got, want)
+	}
+}
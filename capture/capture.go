@@ -0,0 +1,59 @@
+// Package capture provides the image sources the capture tool can read pages
+// from: the live screen, or a replay of previously saved captures.
+package capture
+
+import (
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Frame is one captured page.
+type Frame struct {
+	Image *image.RGBA
+	// Window is true when Image shows the target window, false when it is
+	// a full-screen fallback.
+	Window bool
+	// Bounds is the captured region in screen coordinates.
+	Bounds image.Rectangle
+	// Display is the index of the display holding most of Bounds.
+	Display int
+	// Scale is the number of image pixels per unit of Bounds, or 0 when
+	// unknown.
+	Scale float64
+	// WindowErr explains why the full-screen fallback was used.
+	WindowErr error
+}
+
+// Capturer grabs the current page. Sources that run out of pages return an
+// error wrapping io.EOF.
+type Capturer interface {
+	Capture() (Frame, error)
+	// Name identifies the backend in logs and session records.
+	Name() string
+}
+
+// Decode reads a saved capture back into the form the dedup code works on.
+func Decode(r io.Reader) (*image.RGBA, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return toRGBA(img), nil
+}
+
+// toRGBA converts any decoded image to *image.RGBA, the form the dedup code
+// works on.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,57 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Command captures by running an external program that writes an image to
+// stdout, e.g. "grim -", "scrot -o /dev/stdout", "import -window root png:-"
+// or "adb exec-out screencap -p". It reaches Wayland compositors and devices
+// the screenshot package can't. The whole image counts as the page.
+type Command struct {
+	// Line is run through sh, so it may quote arguments and use pipes
+	Line    string
+	Timeout time.Duration // 0 waits forever
+}
+
+func (c *Command) Name() string { return "command" }
+
+func (c *Command) Capture() (Frame, error) {
+	ctx := context.Background()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.Line)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	// Kill the whole process group on timeout, so pipelines and helpers the
+	// shell started die with it, and stop waiting for stdout shortly after
+	// even if something outside the group still holds it
+	killGroup(cmd)
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return Frame{}, fmt.Errorf("capture command timed out after %v", c.Timeout)
+		}
+		return Frame{}, fmt.Errorf("capture command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return Frame{}, fmt.Errorf("capture command wrote no image: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	img, err := Decode(&stdout)
+	if err != nil {
+		return Frame{}, fmt.Errorf("failed to decode capture command output: %w", err)
+	}
+	return Frame{Image: img, Window: true, Bounds: img.Bounds()}, nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package capture
+
+import "os/exec"
+
+// killGroup leaves cmd alone; WaitDelay bounds the wait for its children
+func killGroup(cmd *exec.Cmd) {}
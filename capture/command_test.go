@@ -0,0 +1,55 @@
+//go:build unix
+
+package capture
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommand(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "page.png")
+	f, err := os.Create(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePNG(t, f, shade(200))
+	f.Close()
+
+	tests := []struct {
+		line    string
+		wantErr string
+	}{
+		{"cat " + page, ""},
+		{"cat " + page + " | cat", ""},
+		{"echo oops >&2; exit 3", "oops"},
+		{"true", "wrote no image"},
+		{"echo not an image", "decode"},
+		// The shell's children hold stdout open after the shell is gone
+		{"sleep 30 | cat", "timed out"},
+		{"(sleep 30; cat " + page + ") &", "timed out"},
+	}
+	for _, tt := range tests {
+		c := &Command{Line: tt.line, Timeout: 500 * time.Millisecond}
+		start := time.Now()
+		frame, err := c.Capture()
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("Capture(%q) took %v", tt.line, elapsed)
+		}
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("Capture(%q) = %v", tt.line, err)
+			} else if r, _, _, _ := frame.Image.At(0, 0).RGBA(); r>>8 != 200 {
+				t.Errorf("Capture(%q) read the wrong image", tt.line)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Capture(%q) = %v, want error containing %q", tt.line, err, tt.wantErr)
+		}
+	}
+}
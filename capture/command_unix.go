@@ -0,0 +1,17 @@
+//go:build unix
+
+package capture
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killGroup runs cmd in its own process group and kills the group when the
+// command's context is done
+func killGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,90 @@
+package capture
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"github.com/kbinani/screenshot"
+)
+
+// AutoDisplay lets the capturer pick the display holding the target window.
+const AutoDisplay = -1
+
+// Displays returns the bounds of every active display, primary first.
+func Displays() []image.Rectangle {
+	n := screenshot.NumActiveDisplays()
+	displays := make([]image.Rectangle, n)
+	for i := range displays {
+		displays[i] = screenshot.GetDisplayBounds(i)
+	}
+	return displays
+}
+
+// DisplayFor returns the display that holds the largest part of r.
+func DisplayFor(displays []image.Rectangle, r image.Rectangle) (int, bool) {
+	best, bestArea := 0, 0
+	for i, d := range displays {
+		overlap := d.Intersect(r)
+		if area := overlap.Dx() * overlap.Dy(); area > bestArea {
+			best, bestArea = i, area
+		}
+	}
+	return best, bestArea > 0
+}
+
+// ParseDisplay resolves a display choice: "auto", an index such as "1", or
+// a geometry "WIDTHxHEIGHT+X+Y" which selects the display it overlaps most.
+func ParseDisplay(spec string, displays []image.Rectangle) (int, error) {
+	if spec == "" || spec == "auto" {
+		return AutoDisplay, nil
+	}
+
+	if i, err := strconv.Atoi(spec); err == nil {
+		if i < 0 || i >= len(displays) {
+			return 0, fmt.Errorf("display %d out of range (%d displays)", i, len(displays))
+		}
+		return i, nil
+	}
+
+	var w, h, x, y int
+	normalized := strings.NewReplacer("+", " +", "-", " -", "x", " ").Replace(spec)
+	if n, err := fmt.Sscanf(normalized, "%d %d %d %d", &w, &h, &x, &y); err != nil || n != 4 {
+		return 0, fmt.Errorf("invalid display %q (want auto, an index or WIDTHxHEIGHT+X+Y)", spec)
+	}
+
+	i, ok := DisplayFor(displays, image.Rect(x, y, x+w, y+h))
+	if !ok {
+		return 0, fmt.Errorf("no display overlaps %s", spec)
+	}
+	return i, nil
+}
+
+// captureRect captures r from every display it touches and stitches the
+// pieces together, so windows spanning two monitors come out whole. The
+// result has scale physical pixels per unit of r.
+func captureRect(displays []image.Rectangle, r image.Rectangle, scale float64) (*image.RGBA, error) {
+	var parts []image.Rectangle
+	for _, d := range displays {
+		if part := r.Intersect(d); !part.Empty() {
+			parts = append(parts, part)
+		}
+	}
+
+	// Entirely inside one display (or off-screen): a single grab will do
+	if len(parts) < 2 {
+		return grabRect(r, scale)
+	}
+
+	out := image.NewRGBA(scaleRect(r.Sub(r.Min), scale))
+	for _, part := range parts {
+		img, err := grabRect(part, scale)
+		if err != nil {
+			return nil, err
+		}
+		draw.Draw(out, scaleRect(part.Sub(r.Min), scale), img, img.Bounds().Min, draw.Src)
+	}
+	return out, nil
+}
@@ -0,0 +1,65 @@
+package capture
+
+import (
+	"image"
+	"testing"
+)
+
+// Two 1920x1080 displays side by side and a portrait one below the first
+var testDisplays = []image.Rectangle{
+	image.Rect(0, 0, 1920, 1080),
+	image.Rect(1920, 0, 3840, 1080),
+	image.Rect(0, 1080, 1080, 3000),
+}
+
+func TestParseDisplay(t *testing.T) {
+	tests := []struct {
+		spec string
+		want int
+		ok   bool
+	}{
+		{"", AutoDisplay, true},
+		{"auto", AutoDisplay, true},
+		{"0", 0, true},
+		{"2", 2, true},
+		{"3", 0, false},
+		{"-1", 0, false},
+		{"800x600+2000+100", 1, true},
+		{"800x600+1800+100", 1, true}, // Mostly on the second display
+		{"800x600+100+1200", 2, true},
+		{"100x100-50-50", 0, true},
+		{"800x600+5000+5000", 0, false},
+		{"800x600", 0, false},
+		{"left", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseDisplay(tt.spec, testDisplays)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseDisplay(%q) error = %v, want ok %v", tt.spec, err, tt.ok)
+			continue
+		}
+		if tt.ok && got != tt.want {
+			t.Errorf("ParseDisplay(%q) = %d, want %d", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestDisplayFor(t *testing.T) {
+	tests := []struct {
+		r    image.Rectangle
+		want int
+		ok   bool
+	}{
+		{image.Rect(100, 100, 500, 500), 0, true},
+		{image.Rect(1900, 0, 2500, 500), 1, true},
+		{image.Rect(1500, 900, 1700, 1200), 0, true},
+		{image.Rect(500, 1000, 700, 1400), 2, true},
+		{image.Rect(-500, -500, -100, -100), 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := DisplayFor(testDisplays, tt.r)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("DisplayFor(%v) = %d, %v, want %d, %v", tt.r, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package capture
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"screenshot-capture/pages"
+)
+
+// Replay serves previously saved images in page order, one per Capture call.
+// It reads either a directory of images or a .zip archive of them.
+type Replay struct {
+	source string
+	names  []string
+	next   int
+	open   func(name string) (io.ReadCloser, error)
+	closer io.Closer
+}
+
+// NewReplay prepares a replay of the images in a directory or .zip archive.
+func NewReplay(source string) (*Replay, error) {
+	r := &Replay{source: source}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay source: %w", err)
+	}
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read replay directory: %w", err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && IsImageFile(entry.Name()) {
+				r.names = append(r.names, entry.Name())
+			}
+		}
+		r.open = func(name string) (io.ReadCloser, error) {
+			return os.Open(filepath.Join(source, name))
+		}
+	} else {
+		archive, err := zip.OpenReader(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open replay archive: %w", err)
+		}
+		files := make(map[string]*zip.File)
+		for _, f := range archive.File {
+			if !f.FileInfo().IsDir() && IsImageFile(f.Name) {
+				r.names = append(r.names, f.Name)
+				files[f.Name] = f
+			}
+		}
+		r.open = func(name string) (io.ReadCloser, error) {
+			return files[name].Open()
+		}
+		r.closer = archive
+	}
+
+	if len(r.names) == 0 {
+		r.Close()
+		return nil, fmt.Errorf("no images found in %s", source)
+	}
+	pages.Sort(r.names)
+
+	return r, nil
+}
+
+func (r *Replay) Name() string { return "replay" }
+
+// Capture decodes the next image. It returns io.EOF once every image has
+// been served.
+func (r *Replay) Capture() (Frame, error) {
+	if r.next >= len(r.names) {
+		return Frame{}, io.EOF
+	}
+	name := r.names[r.next]
+	r.next++
+
+	file, err := r.open(name)
+	if err != nil {
+		return Frame{}, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer file.Close()
+
+	rgba, err := Decode(file)
+	if err != nil {
+		return Frame{}, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+
+	return Frame{Image: rgba, Window: true, Bounds: rgba.Bounds()}, nil
+}
+
+// Current returns the name of the image served by the last Capture call.
+func (r *Replay) Current() string {
+	if r.next == 0 {
+		return ""
+	}
+	return r.names[r.next-1]
+}
+
+// Close releases the archive, if any.
+func (r *Replay) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// IsImageFile reports whether name has the extension of a supported capture
+// format.
+func IsImageFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".webp":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package capture
+
+import (
+	"archive/zip"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// shade returns a small image filled with one gray level, so frames can be
+// told apart after decoding.
+func shade(level uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, color.Gray{level})
+		}
+	}
+	return img
+}
+
+func writePNG(t *testing.T, w io.Writer, img image.Image) {
+	t.Helper()
+	if err := png.Encode(w, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// replayAll captures until io.EOF and returns the gray level and source
+// name of every frame.
+func replayAll(t *testing.T, r *Replay) ([]uint8, []string) {
+	t.Helper()
+	var levels []uint8
+	var names []string
+	for {
+		frame, err := r.Capture()
+		if errors.Is(err, io.EOF) {
+			return levels, names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !frame.Window || frame.Bounds != image.Rect(0, 0, 4, 3) {
+			t.Errorf("frame %s: window %v, bounds %v", r.Current(), frame.Window, frame.Bounds)
+		}
+		levels = append(levels, frame.Image.RGBAAt(0, 0).R)
+		names = append(names, r.Current())
+	}
+}
+
+// Files are served in natural page order, whatever order they are stored in
+var replayFiles = []struct {
+	name  string
+	level uint8
+}{
+	{"kindle_10.png", 30},
+	{"kindle_2.png", 20},
+	{"kindle_1.png", 10},
+	{"notes.txt", 0},
+}
+
+func checkReplay(t *testing.T, r *Replay) {
+	t.Helper()
+	defer r.Close()
+
+	if r.Current() != "" {
+		t.Errorf("Current before the first capture = %q, want empty", r.Current())
+	}
+	levels, names := replayAll(t, r)
+	wantLevels := []uint8{10, 20, 30}
+	wantNames := []string{"kindle_1.png", "kindle_2.png", "kindle_10.png"}
+	if len(levels) != len(wantLevels) {
+		t.Fatalf("replayed %v, want %v", names, wantNames)
+	}
+	for i := range levels {
+		if levels[i] != wantLevels[i] || names[i] != wantNames[i] {
+			t.Errorf("frame %d = %s (level %d), want %s (level %d)", i, names[i], levels[i], wantNames[i], wantLevels[i])
+		}
+	}
+
+	// Exhausted sources keep returning io.EOF
+	if _, err := r.Capture(); !errors.Is(err, io.EOF) {
+		t.Errorf("Capture after the last frame = %v, want io.EOF", err)
+	}
+}
+
+func TestReplayDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range replayFiles {
+		file, err := os.Create(filepath.Join(dir, f.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.level != 0 {
+			writePNG(t, file, shade(f.level))
+		}
+		file.Close()
+	}
+
+	r, err := NewReplay(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReplay(t, r)
+}
+
+func TestReplayArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pages.zip")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(file)
+	for _, f := range replayFiles {
+		w, err := archive.Create("book/" + f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.level != 0 {
+			writePNG(t, w, shade(f.level))
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	r, err := NewReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	levels, names := replayAll(t, r)
+	if len(levels) != 3 || levels[0] != 10 || levels[1] != 20 || levels[2] != 30 || names[2] != "book/kindle_10.png" {
+		t.Errorf("replayed %v with levels %v, want book/kindle_1, 2 and 10", names, levels)
+	}
+}
+
+func TestReplayEmpty(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("no pages"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReplay(dir); err == nil {
+		t.Error("NewReplay of a directory without images succeeded")
+	}
+	if _, err := NewReplay(filepath.Join(dir, "missing")); err == nil {
+		t.Error("NewReplay of a missing source succeeded")
+	}
+}
+
+func TestIsImageFile(t *testing.T) {
+	tests := map[string]bool{
+		"kindle_001.png":   true,
+		"kindle_001.PNG":   true,
+		"page.jpg":         true,
+		"page.jpeg":        true,
+		"page.webp":        true,
+		"manifest.jsonl":   false,
+		"page.png.tmp":     false,
+		"png":              false,
+		"calibration.json": false,
+	}
+	for name, want := range tests {
+		if got := IsImageFile(name); got != want {
+			t.Errorf("IsImageFile(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
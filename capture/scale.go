@@ -0,0 +1,41 @@
+package capture
+
+import (
+	"image"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// BaseDPI is the resolution given to a capture at scale 1, after the CSS
+// reference pixel. A Retina capture at scale 2 is thus 192 DPI.
+const BaseDPI = 96
+
+// scaleRect converts a rectangle in window coordinates to physical pixels.
+func scaleRect(r image.Rectangle, scale float64) image.Rectangle {
+	if scale == 1 {
+		return r
+	}
+	at := func(v int) int { return int(math.Round(float64(v) * scale)) }
+	return image.Rect(at(r.Min.X), at(r.Min.Y), at(r.Max.X), at(r.Max.Y))
+}
+
+// downsample shrinks img, captured at scale, to targetDPI if it is sharper
+// than that. It returns the resulting image and its scale.
+func downsample(img *image.RGBA, scale float64, targetDPI int) (*image.RGBA, float64) {
+	target := float64(targetDPI) / BaseDPI
+	if targetDPI <= 0 || target >= scale {
+		return img, scale
+	}
+
+	b := img.Bounds()
+	f := target / scale
+	w := max(1, int(math.Round(float64(b.Dx())*f)))
+	h := max(1, int(math.Round(float64(b.Dy())*f)))
+
+	// Catmull-Rom averages over the whole source footprint, so thin glyph
+	// strokes fade rather than vanish
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(out, out.Bounds(), img, b, xdraw.Src, nil)
+	return out, scale * float64(w) / float64(b.Dx())
+}
@@ -0,0 +1,71 @@
+package capture
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/kbinani/screenshot"
+)
+
+// scaleScript prints the backing scale factor of every active display, in
+// the order screenshot.GetDisplayBounds numbers them.
+const scaleScript = `
+import Quartz
+
+err, ids, count = Quartz.CGGetActiveDisplayList(32, None, None)
+for display in ids[:count]:
+    mode = Quartz.CGDisplayCopyDisplayMode(display)
+    print(Quartz.CGDisplayModeGetPixelWidth(mode) / Quartz.CGDisplayModeGetWidth(mode))
+`
+
+// detectScales returns the pixels per point of every display.
+func detectScales() ([]float64, error) {
+	output, err := exec.Command("python3", "-c", scaleScript).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect display scale: %w", err)
+	}
+
+	var scales []float64
+	for _, line := range strings.Fields(string(output)) {
+		scale, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid display scale %q", line)
+		}
+		scales = append(scales, scale)
+	}
+	return scales, nil
+}
+
+// grabRect captures r, given in points. CoreGraphics through the screenshot
+// package renders one pixel per point, so HiDPI captures go through the
+// screencapture tool, which keeps the full backing resolution.
+func grabRect(r image.Rectangle, scale float64) (*image.RGBA, error) {
+	if scale <= 1 {
+		return screenshot.CaptureRect(r)
+	}
+
+	file, err := os.CreateTemp("", "capture-*.png")
+	if err != nil {
+		return nil, err
+	}
+	path := file.Name()
+	file.Close()
+	defer os.Remove(path)
+
+	region := fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	if out, err := exec.Command("screencapture", "-x", "-t", "png", "-R", region, path).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("screencapture failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	file, err = os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Decode(file)
+}
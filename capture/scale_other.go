@@ -0,0 +1,20 @@
+//go:build !darwin
+
+package capture
+
+import (
+	"image"
+
+	"github.com/kbinani/screenshot"
+)
+
+// detectScales returns nothing: X11 and Windows report window bounds in
+// physical pixels already, so the scale is 1 unless overridden.
+func detectScales() ([]float64, error) {
+	return nil, nil
+}
+
+// grabRect captures r, converting it to physical pixels first.
+func grabRect(r image.Rectangle, scale float64) (*image.RGBA, error) {
+	return screenshot.CaptureRect(scaleRect(r, scale))
+}
@@ -0,0 +1,85 @@
+package capture
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestScaleRect(t *testing.T) {
+	tests := []struct {
+		r     image.Rectangle
+		scale float64
+		want  image.Rectangle
+	}{
+		{image.Rect(10, 20, 810, 620), 1, image.Rect(10, 20, 810, 620)},
+		{image.Rect(10, 20, 810, 620), 2, image.Rect(20, 40, 1620, 1240)},
+		{image.Rect(0, 0, 1440, 900), 1.5, image.Rect(0, 0, 2160, 1350)},
+		// Odd coordinates round half away from zero
+		{image.Rect(1, 3, 101, 75), 1.5, image.Rect(2, 5, 152, 113)},
+		{image.Rect(-3, -1, 7, 9), 1.5, image.Rect(-5, -2, 11, 14)},
+		{image.Rect(1, 3, 101, 75), 2, image.Rect(2, 6, 202, 150)},
+	}
+	for _, tt := range tests {
+		if got := scaleRect(tt.r, tt.scale); got != tt.want {
+			t.Errorf("scaleRect(%v, %v) = %v, want %v", tt.r, tt.scale, got, tt.want)
+		}
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	gray := color.RGBA{128, 128, 128, 255}
+	page := func(r image.Rectangle) *image.RGBA {
+		img := image.NewRGBA(r)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.SetRGBA(x, y, gray)
+			}
+		}
+		return img
+	}
+
+	tests := []struct {
+		name      string
+		bounds    image.Rectangle
+		scale     float64
+		targetDPI int
+		want      image.Rectangle // bounds after downsampling
+		wantScale float64
+	}{
+		{"retina to 1x", image.Rect(0, 0, 200, 100), 2, 96, image.Rect(0, 0, 100, 50), 1},
+		{"retina to 1.5x", image.Rect(0, 0, 100, 50), 2, 144, image.Rect(0, 0, 75, 38), 1.5},
+		{"1.5x to 1x, odd size", image.Rect(0, 0, 301, 201), 1.5, 96, image.Rect(0, 0, 201, 134), 1.5 * 201 / 301},
+		{"offset bounds", image.Rect(50, 30, 250, 130), 2, 96, image.Rect(0, 0, 100, 50), 1},
+		{"single pixel", image.Rect(0, 0, 1, 1), 4, 96, image.Rect(0, 0, 1, 1), 4},
+	}
+	for _, tt := range tests {
+		got, scale := downsample(page(tt.bounds), tt.scale, tt.targetDPI)
+		if got.Bounds() != tt.want || math.Abs(scale-tt.wantScale) > 1e-9 {
+			t.Errorf("%s: downsample() = %v at scale %v, want %v at scale %v", tt.name, got.Bounds(), scale, tt.want, tt.wantScale)
+			continue
+		}
+		if c := got.RGBAAt(got.Bounds().Dx()/2, got.Bounds().Dy()/2); c != gray {
+			t.Errorf("%s: downsampled pixel = %v, want %v", tt.name, c, gray)
+		}
+	}
+
+	// Captures at or below the target resolution are returned as they are
+	noops := []struct {
+		scale     float64
+		targetDPI int
+	}{
+		{2, 192},
+		{2, 240},
+		{1, 96},
+		{1.5, 144},
+		{2, 0},
+	}
+	for _, tt := range noops {
+		img := page(image.Rect(0, 0, 31, 17))
+		if got, scale := downsample(img, tt.scale, tt.targetDPI); got != img || scale != tt.scale {
+			t.Errorf("downsample(scale %v, %d DPI) = %v at scale %v, want the capture unchanged", tt.scale, tt.targetDPI, got.Bounds(), scale)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package capture
+
+import (
+	"fmt"
+	"image"
+	"slices"
+	"sync"
+
+	"screenshot-capture/window"
+)
+
+// Screen captures the target window from the live displays, falling back to
+// a whole display when the window cannot be found.
+type Screen struct {
+	Target window.Matcher
+	// Display restricts the window search and the fallback to one display.
+	// AutoDisplay follows the window, falling back to the primary display.
+	Display int
+	// Insets trim the window down to the page content.
+	Insets window.Insets
+	// Scale is the number of physical pixels per unit of window coordinates
+	// (2 on a Retina display). 0 detects it per display.
+	Scale float64
+	// TargetDPI downsamples sharper captures to this resolution, counting
+	// scale 1 as BaseDPI. 0 keeps the full resolution.
+	TargetDPI int
+
+	mu       sync.Mutex
+	scales   []float64         // Detected scale per display
+	scalesOf []image.Rectangle // Display layout scales was detected for
+}
+
+func (s *Screen) Name() string { return "screen" }
+
+func (s *Screen) Capture() (Frame, error) {
+	displays := Displays()
+
+	// Locate the target window (Quartz on macOS, the X11 window tree on Linux)
+	win, err := s.findWindow(displays)
+	if err == nil {
+		content := s.Insets.Apply(win.Bounds)
+		display, _ := DisplayFor(displays, content)
+		scale := s.scaleOf(displays, display)
+		img, err := captureRect(displays, content, scale)
+		if err != nil {
+			return Frame{}, fmt.Errorf("failed to capture %s window: %w", s.Target.Name, err)
+		}
+		img, scale = s.finish(img, content)
+		return Frame{Image: img, Window: true, Bounds: content, Display: display, Scale: scale}, nil
+	}
+
+	display := s.Display
+	if display == AutoDisplay {
+		display = 0
+	}
+	if display >= len(displays) {
+		return Frame{}, fmt.Errorf("display %d not connected", display)
+	}
+
+	bounds := displays[display]
+	img, captureErr := captureRect(displays, bounds, s.scaleOf(displays, display))
+	if captureErr != nil {
+		return Frame{}, fmt.Errorf("failed to capture display %d: %w", display, captureErr)
+	}
+	img, scale := s.finish(img, bounds)
+	return Frame{Image: img, Bounds: bounds, Display: display, Scale: scale, WindowErr: err}, nil
+}
+
+// finish measures the scale img was actually captured at, which the
+// capture tool may have rounded, and downsamples it to the target DPI.
+func (s *Screen) finish(img *image.RGBA, bounds image.Rectangle) (*image.RGBA, float64) {
+	scale := float64(img.Bounds().Dx()) / float64(bounds.Dx())
+	return downsample(img, scale, s.TargetDPI)
+}
+
+// scaleOf returns the scale of a display: the override if set, else the
+// detected one. Detection is repeated only when the display layout changes.
+func (s *Screen) scaleOf(displays []image.Rectangle, display int) float64 {
+	if s.Scale > 0 {
+		return s.Scale
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !slices.Equal(s.scalesOf, displays) {
+		scales, err := detectScales()
+		if err != nil {
+			fmt.Printf("%v, assuming scale 1\n", err)
+		}
+		s.scales, s.scalesOf = scales, displays
+	}
+	if display < len(s.scales) && s.scales[display] > 0 {
+		return s.scales[display]
+	}
+	return 1
+}
+
+func (s *Screen) findWindow(displays []image.Rectangle) (window.Info, error) {
+	windows, err := window.List()
+	if err != nil {
+		return window.Info{}, err
+	}
+
+	if s.Display != AutoDisplay && s.Display < len(displays) {
+		var onDisplay []window.Info
+		for _, w := range windows {
+			if w.Bounds.Overlaps(displays[s.Display]) {
+				onDisplay = append(onDisplay, w)
+			}
+		}
+		windows = onDisplay
+	}
+
+	return s.Target.Select(windows)
+}
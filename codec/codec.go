@@ -0,0 +1,203 @@
+// Package codec encodes captures in the storage formats the capture tool
+// supports. Text pages shrink dramatically as grayscale or palette images,
+// which matters when whole books are archived.
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// Formats
+const (
+	PNG          = "png"           // Full-colour RGBA PNG
+	Gray         = "gray"          // 8-bit grayscale PNG
+	Palette      = "palette"       // Palette-quantised PNG
+	JPEG         = "jpeg"          // Lossy JPEG
+	WebP         = "webp"          // Lossy WebP, via the cwebp tool
+	WebPLossless = "webp-lossless" // Lossless WebP, via the cwebp tool
+)
+
+// Options selects the output format and its parameters.
+type Options struct {
+	Format  string
+	Quality int // 1-100, for JPEG and lossy WebP
+	Colors  int // 2-256, for palette PNG
+}
+
+// Validate checks the format name and parameter ranges, and that the
+// encoder the format needs is installed.
+func (o Options) Validate() error {
+	switch o.Format {
+	case PNG, Gray, Palette, JPEG, WebP, WebPLossless:
+	default:
+		return fmt.Errorf("unknown format %q (want png, gray, palette, jpeg, webp or webp-lossless)", o.Format)
+	}
+	if o.Quality < 1 || o.Quality > 100 {
+		return fmt.Errorf("quality %d out of range 1-100", o.Quality)
+	}
+	if o.Colors < 2 || o.Colors > 256 {
+		return fmt.Errorf("colors %d out of range 2-256", o.Colors)
+	}
+	if o.Format == WebP || o.Format == WebPLossless {
+		if _, err := exec.LookPath("cwebp"); err != nil {
+			return fmt.Errorf("%s needs the cwebp tool from libwebp: %w", o.Format, err)
+		}
+	}
+	return nil
+}
+
+// Lossless reports whether decoding a saved file gives back the captured
+// pixels exactly.
+func (o Options) Lossless() bool {
+	return o.Format == PNG || o.Format == WebPLossless
+}
+
+// Ext returns the file extension for the format, including the dot.
+func (o Options) Ext() string {
+	switch o.Format {
+	case JPEG:
+		return ".jpg"
+	case WebP, WebPLossless:
+		return ".webp"
+	}
+	return ".png"
+}
+
+// Encode writes img to w in the selected format.
+func Encode(w io.Writer, img image.Image, o Options) error {
+	switch o.Format {
+	case Gray:
+		return png.Encode(w, toGray(img))
+	case Palette:
+		return png.Encode(w, quantize(img, o.Colors))
+	case JPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: o.Quality})
+	case WebP, WebPLossless:
+		return encodeWebP(w, img, o)
+	}
+	return png.Encode(w, img)
+}
+
+func toGray(img image.Image) *image.Gray {
+	b := img.Bounds()
+	gray := image.NewGray(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			gray.Set(x, y, img.At(x, y))
+		}
+	}
+	return gray
+}
+
+// quantize builds a palette from the most common colours (bucketed at 5 bits
+// per channel) and maps every pixel to its nearest palette entry. Dithering
+// is deliberately skipped: it blurs glyph edges for OCR.
+func quantize(img image.Image, colors int) *image.Paletted {
+	const buckets = 1 << 15
+	bucketOf := func(c color.Color) int {
+		r, g, b, _ := c.RGBA()
+		return int(r>>11)<<10 | int(g>>11)<<5 | int(b>>11)
+	}
+
+	type stat struct {
+		count   int
+		r, g, b int
+	}
+	stats := make([]stat, buckets)
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.At(x, y)
+			r, g, b, _ := c.RGBA()
+			s := &stats[bucketOf(c)]
+			s.count++
+			s.r += int(r >> 8)
+			s.g += int(g >> 8)
+			s.b += int(b >> 8)
+		}
+	}
+
+	var used []stat
+	for _, s := range stats {
+		if s.count > 0 {
+			used = append(used, s)
+		}
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i].count > used[j].count })
+	if len(used) > colors {
+		used = used[:colors]
+	}
+
+	palette := make(color.Palette, len(used))
+	for i, s := range used {
+		palette[i] = color.RGBA{uint8(s.r / s.count), uint8(s.g / s.count), uint8(s.b / s.count), 255}
+	}
+
+	// Nearest-colour lookups are cached per bucket
+	lookup := make([]int16, buckets)
+	for i := range lookup {
+		lookup[i] = -1
+	}
+
+	out := image.NewPaletted(bounds, palette)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.At(x, y)
+			bucket := bucketOf(c)
+			if lookup[bucket] < 0 {
+				lookup[bucket] = int16(palette.Index(c))
+			}
+			out.SetColorIndex(x, y, uint8(lookup[bucket]))
+		}
+	}
+	return out
+}
+
+// encodeWebP shells out to cwebp, as the Go image libraries can only decode
+// WebP.
+func encodeWebP(w io.Writer, img image.Image, o Options) error {
+	dir, err := os.MkdirTemp("", "capture-webp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "in.png")
+	output := filepath.Join(dir, "out.webp")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	if err := os.WriteFile(input, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+
+	args := []string{"-quiet", "-q", fmt.Sprint(o.Quality)}
+	if o.Format == WebPLossless {
+		args = []string{"-quiet", "-lossless", "-z", "9"}
+	}
+	args = append(args, input, "-o", output)
+
+	if out, err := exec.Command("cwebp", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("cwebp failed: %w: %s", err, bytes.TrimSpace(out))
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,91 @@
+package codec
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os/exec"
+	"testing"
+
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+func TestValidate(t *testing.T) {
+	_, cwebpErr := exec.LookPath("cwebp")
+
+	tests := []struct {
+		o  Options
+		ok bool
+	}{
+		{Options{Format: PNG, Quality: 90, Colors: 256}, true},
+		{Options{Format: Gray, Quality: 90, Colors: 256}, true},
+		{Options{Format: Palette, Quality: 90, Colors: 2}, true},
+		{Options{Format: JPEG, Quality: 1, Colors: 256}, true},
+		{Options{Format: WebP, Quality: 90, Colors: 256}, cwebpErr == nil},
+		{Options{Format: WebPLossless, Quality: 90, Colors: 256}, cwebpErr == nil},
+		{Options{Format: "tiff", Quality: 90, Colors: 256}, false},
+		{Options{Format: JPEG, Quality: 0, Colors: 256}, false},
+		{Options{Format: JPEG, Quality: 101, Colors: 256}, false},
+		{Options{Format: Palette, Quality: 90, Colors: 1}, false},
+		{Options{Format: Palette, Quality: 90, Colors: 257}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.o.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate(%+v) = %v, want ok %v", tt.o, err, tt.ok)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 5), 200, 255})
+		}
+	}
+
+	for _, format := range []string{PNG, Gray, Palette, JPEG} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, img, Options{Format: format, Quality: 90, Colors: 16}); err != nil {
+			t.Errorf("Encode(%s): %v", format, err)
+			continue
+		}
+		decoded, _, err := image.Decode(&buf)
+		if err != nil {
+			t.Errorf("decoding %s: %v", format, err)
+			continue
+		}
+		if decoded.Bounds() != img.Bounds() {
+			t.Errorf("%s bounds = %v, want %v", format, decoded.Bounds(), img.Bounds())
+		}
+
+		switch format {
+		case Gray:
+			if _, ok := decoded.(*image.Gray); !ok {
+				t.Errorf("gray decoded as %T", decoded)
+			}
+		case Palette:
+			p, ok := decoded.(*image.Paletted)
+			if !ok || len(p.Palette) > 16 {
+				t.Errorf("palette decoded as %T, want at most 16 colours", decoded)
+			}
+		}
+	}
+}
+
+func TestExt(t *testing.T) {
+	for format, want := range map[string]string{PNG: ".png", Gray: ".png", Palette: ".png", JPEG: ".jpg", WebP: ".webp", WebPLossless: ".webp"} {
+		if got := (Options{Format: format}).Ext(); got != want {
+			t.Errorf("Ext(%s) = %q, want %q", format, got, want)
+		}
+	}
+}
+
+func TestLossless(t *testing.T) {
+	for format, want := range map[string]bool{PNG: true, WebPLossless: true, Gray: false, Palette: false, JPEG: false, WebP: false} {
+		if got := (Options{Format: format}).Lossless(); got != want {
+			t.Errorf("Lossless(%s) = %v, want %v", format, got, want)
+		}
+	}
+}
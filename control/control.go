@@ -0,0 +1,154 @@
+// Package control serves a small HTTP API for driving the capture tool from
+// scripts and dashboards instead of the global hotkeys.
+package control
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"net"
+	"net/http"
+)
+
+// TokenHeader carries the session token on every request. Browsers cannot
+// send a custom header cross-origin without a preflight, which the API never
+// answers, and a rebound DNS name fails the Host check.
+const TokenHeader = "X-Capture-Token"
+
+// Stats summarises the capture session.
+type Stats struct {
+	Session    string   `json:"session"`
+	Saved      int      `json:"saved"`
+	Duplicates int      `json:"duplicates"`
+	Rejected   int      `json:"rejected"`
+	Failed     int      `json:"failed"`
+	LastDiff   *float64 `json:"last_diff,omitempty"` // Ratio of differing pixels in the last similarity check
+	LastFile   string   `json:"last_file,omitempty"`
+	Auto       string   `json:"auto"` // idle, running or paused
+}
+
+// Controller is the capture tool as seen by the API.
+type Controller interface {
+	// Capture takes one capture and returns its outcome, such as "saved"
+	// or "duplicate"
+	Capture(force bool) string
+	StartAuto() error
+	PauseAuto() error
+	ResumeAuto() error
+	StopAuto() error
+	Stats() Stats
+	// Latest returns the most recently saved page, or nil
+	Latest() image.Image
+}
+
+// NewHandler routes the API to c, answering only requests addressed to a
+// loopback host on port and carrying token in TokenHeader:
+//
+//	POST /capture[?force=1]  take a capture
+//	POST /auto/start         start auto capture
+//	POST /auto/pause         pause auto capture
+//	POST /auto/resume        resume auto capture
+//	POST /auto/stop          stop auto capture after the current page
+//	GET  /stats              session statistics
+//	GET  /latest.png         the latest saved page
+func NewHandler(c Controller, port, token string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /capture", func(w http.ResponseWriter, r *http.Request) {
+		force := r.URL.Query().Get("force")
+		writeJSON(w, http.StatusOK, map[string]string{"result": c.Capture(force == "1" || force == "true")})
+	})
+
+	for name, action := range map[string]func() error{
+		"start":  c.StartAuto,
+		"pause":  c.PauseAuto,
+		"resume": c.ResumeAuto,
+		"stop":   c.StopAuto,
+	} {
+		mux.HandleFunc("POST /auto/"+name, func(w http.ResponseWriter, r *http.Request) {
+			if err := action(); err != nil {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, c.Stats())
+		})
+	}
+
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Stats())
+	})
+
+	mux.HandleFunc("GET /latest.png", func(w http.ResponseWriter, r *http.Request) {
+		img := c.Latest()
+		if img == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "no page saved yet"})
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		png.Encode(w, img)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !loopbackHost(r.Host, port) {
+			writeJSON(w, http.StatusMisdirectedRequest, map[string]string{"error": "unexpected host " + r.Host})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(TokenHeader)), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or wrong " + TokenHeader})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// loopbackHost reports whether a Host header names this machine on port
+func loopbackHost(hostport, port string) bool {
+	host, p, err := net.SplitHostPort(hostport)
+	if err != nil || p != port {
+		return false
+	}
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// NewToken returns a random session token
+func NewToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Serve starts the API on addr in the background. Only loopback addresses
+// are accepted, and clients must send token in TokenHeader.
+func Serve(addr, token string, c Controller) (*http.Server, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("%s is not a loopback address", host)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("empty API token")
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	server := &http.Server{Handler: NewHandler(c, port, token)}
+	go server.Serve(listener)
+	return server, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
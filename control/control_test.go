@@ -0,0 +1,143 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeController struct {
+	captures []bool
+	auto     string
+	latest   image.Image
+}
+
+func (f *fakeController) Capture(force bool) string {
+	f.captures = append(f.captures, force)
+	return "saved"
+}
+
+func (f *fakeController) StartAuto() error {
+	if f.auto == "running" {
+		return errors.New("auto capture is already running")
+	}
+	f.auto = "running"
+	return nil
+}
+
+func (f *fakeController) PauseAuto() error  { f.auto = "paused"; return nil }
+func (f *fakeController) ResumeAuto() error { f.auto = "running"; return nil }
+func (f *fakeController) StopAuto() error   { f.auto = "idle"; return nil }
+func (f *fakeController) Stats() Stats      { return Stats{Saved: len(f.captures), Auto: f.auto} }
+func (f *fakeController) Latest() image.Image {
+	return f.latest
+}
+
+const testToken = "secret"
+
+func serve(h http.Handler, method, target, host, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	r.Host = host
+	if token != "" {
+		r.Header.Set(TokenHeader, token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestGuard(t *testing.T) {
+	tests := []struct {
+		host, token string
+		want        int
+	}{
+		{"127.0.0.1:8765", testToken, http.StatusOK},
+		{"localhost:8765", testToken, http.StatusOK},
+		{"[::1]:8765", testToken, http.StatusOK},
+		{"127.0.0.1:8765", "", http.StatusUnauthorized},
+		{"127.0.0.1:8765", "wrong", http.StatusUnauthorized},
+		{"127.0.0.1:9999", testToken, http.StatusMisdirectedRequest},
+		{"127.0.0.1", testToken, http.StatusMisdirectedRequest},
+		{"evil.example:8765", testToken, http.StatusMisdirectedRequest},
+	}
+	for _, tt := range tests {
+		f := &fakeController{}
+		h := NewHandler(f, "8765", testToken)
+		for _, route := range []struct{ method, target string }{
+			{"GET", "/stats"},
+			{"POST", "/capture"},
+			{"POST", "/auto/start"},
+		} {
+			w := serve(h, route.method, route.target, tt.host, tt.token)
+			if w.Code != tt.want {
+				t.Errorf("%s %s with host %q, token %q = %d, want %d", route.method, route.target, tt.host, tt.token, w.Code, tt.want)
+			}
+		}
+		if tt.want != http.StatusOK && (len(f.captures) > 0 || f.auto != "") {
+			t.Errorf("host %q, token %q reached the controller", tt.host, tt.token)
+		}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	f := &fakeController{}
+	h := NewHandler(f, "8765", testToken)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		return serve(h, method, target, "127.0.0.1:8765", testToken)
+	}
+
+	if w := do("POST", "/capture?force=1"); w.Code != http.StatusOK || len(f.captures) != 1 || !f.captures[0] {
+		t.Errorf("POST /capture?force=1 = %d, captures %v", w.Code, f.captures)
+	}
+	if w := do("GET", "/capture"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /capture = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	tests := []struct {
+		target string
+		code   int
+		auto   string
+	}{
+		{"/auto/start", http.StatusOK, "running"},
+		{"/auto/start", http.StatusConflict, "running"},
+		{"/auto/pause", http.StatusOK, "paused"},
+		{"/auto/resume", http.StatusOK, "running"},
+		{"/auto/stop", http.StatusOK, "idle"},
+	}
+	for _, tt := range tests {
+		w := do("POST", tt.target)
+		if w.Code != tt.code || f.auto != tt.auto {
+			t.Errorf("POST %s = %d, auto %q, want %d, %q", tt.target, w.Code, f.auto, tt.code, tt.auto)
+		}
+	}
+
+	w := do("GET", "/stats")
+	var stats Stats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil || stats.Saved != 1 || stats.Auto != "idle" {
+		t.Errorf("GET /stats = %+v, %v", stats, err)
+	}
+
+	if w := do("GET", "/latest.png"); w.Code != http.StatusNotFound {
+		t.Errorf("GET /latest.png before any page = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	f.latest = image.NewRGBA(image.Rect(0, 0, 2, 2))
+	if w := do("GET", "/latest.png"); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("GET /latest.png = %d, %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestServe(t *testing.T) {
+	for _, addr := range []string{"0.0.0.0:0", "192.0.2.1:0", "example.com:0"} {
+		if server, err := Serve(addr, testToken, &fakeController{}); err == nil {
+			server.Close()
+			t.Errorf("Serve(%q) accepted a non-loopback address", addr)
+		}
+	}
+	if server, err := Serve("127.0.0.1:0", "", &fakeController{}); err == nil {
+		server.Close()
+		t.Errorf("Serve accepted an empty token")
+	}
+}
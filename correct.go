@@ -11,6 +11,8 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"screenshot-capture/pages"
 )
 
 const (
@@ -56,7 +58,7 @@ func main() {
 		return
 	}
 
-	sort.Strings(files)
+	pages.Sort(files)
 
 	fmt.Printf("Found %d chapter files\n\n", len(files))
 
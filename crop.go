@@ -2,28 +2,58 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"image"
+	_ "image/jpeg"
 	"image/png"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/otiai10/gosseract/v2"
 	"github.com/sashabaranov/go-openai"
+	_ "golang.org/x/image/webp"
+
+	"screenshot-capture/manifest"
+	"screenshot-capture/pages"
+	"screenshot-capture/profile"
 )
 
 const (
 	inputDir     = "/Users/leo/dev/work/scanner/screenshots"
 	outputDir    = "/Users/leo/dev/work/scanner/cropped"
 	outputMDFile = "/Users/leo/dev/work/scanner/output.md"
-	topMargin    = 0.08 // 5% from top
-	bottomMargin = 0.05 // 5% from bottom
 )
 
 func main() {
+	profileName := flag.String("profile", "", "reader app profile whose margins and page layout to use (default: the one recorded in the capture manifest, else kindle)")
+	flag.Parse()
+
+	records, err := manifest.Read(filepath.Join(inputDir, "manifest.jsonl"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring the capture manifest: %v\n", err)
+	}
+	readerProfile, err := loadProfile(*profileName, records)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Cropping %s pages (%s layout, %.0f%% top and %.0f%% bottom margins)\n",
+		readerProfile.Name, readerProfile.Layout, readerProfile.TopMargin*100, readerProfile.BottomMargin*100)
+
+	// Calibrated captures have no window chrome left to cut
+	calibrated := map[string]bool{}
+	for _, r := range records {
+		if r.Decision == manifest.Saved && r.Calibrated {
+			calibrated[r.File] = true
+		}
+	}
+	if len(calibrated) > 0 {
+		fmt.Printf("Keeping the margins of %d calibrated captures\n", len(calibrated))
+	}
+
 	// Load .env file
 	if err := godotenv.Load(); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: Error loading .env file: %v\n", err)
@@ -52,17 +82,19 @@ func main() {
 		return
 	}
 
-	// Filter and sort PNG files
-	var pngFiles []string
+	// Filter and sort capture files (PNG, JPEG or WebP, see the capture -format flag)
+	var imageFiles []string
 	for _, file := range files {
 		if file.IsDir() {
 			continue
 		}
-		if strings.HasSuffix(strings.ToLower(file.Name()), ".png") {
-			pngFiles = append(pngFiles, file.Name())
+		switch strings.ToLower(filepath.Ext(file.Name())) {
+		case ".png", ".jpg", ".jpeg", ".webp":
+			imageFiles = append(imageFiles, file.Name())
 		}
 	}
-	sort.Strings(pngFiles)
+	// Natural order, so page 1000 comes after page 999
+	pages.Sort(imageFiles)
 
 	// Initialize Tesseract client
 	client := gosseract.NewClient()
@@ -105,58 +137,45 @@ func main() {
 		return nil
 	}
 
+	// Pages in reading order within each capture
+	sides := []string{"page"}
+	if readerProfile.Layout == profile.Spread {
+		sides = []string{"left", "right"}
+	}
+
 	// Process each file
-	for _, fileName := range pngFiles {
+	for _, fileName := range imageFiles {
 		inputPath := filepath.Join(inputDir, fileName)
 
-		// Create output paths for left and right pages
-		baseName := strings.TrimSuffix(fileName, ".png")
-		leftPath := filepath.Join(outputDir, baseName+"_left.png")
-		rightPath := filepath.Join(outputDir, baseName+"_right.png")
+		// Create output paths for each page
+		baseName := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+		pagePaths := make([]string, len(sides))
+		for i, side := range sides {
+			pagePaths[i] = filepath.Join(outputDir, baseName+"_"+side+".png")
+		}
 
-		// Crop and split the image into left and right halves
-		if err := cropAndSplitImage(inputPath, leftPath, rightPath); err != nil {
+		// Crop the image and split it into its pages
+		top, bottom := readerProfile.TopMargin, readerProfile.BottomMargin
+		if calibrated[fileName] {
+			top, bottom = 0, 0
+		}
+		if err := cropAndSplitImage(inputPath, pagePaths, top, bottom); err != nil {
 			fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", fileName, err)
 			continue
 		}
 
-		// Process left page
-		client.SetImage(leftPath)
-		leftText, err := client.Text()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error performing OCR on %s (left): %v\n", fileName, err)
-		} else {
-			leftText = cleanText(leftText)
-
-			// Check if this is a new chapter start
-			if isChapterStart(leftText) {
-				fmt.Printf("\n📖 Chapter start detected: %s (left page) - %s\n", fileName, getFirstLine(leftText))
-
-				// Process previous chapter if exists
-				if err := processChapter(); err != nil {
-					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-					return
-				}
-			}
-
-			// Add to current chapter
-			currentChapter.WriteString(leftText)
-			if !strings.HasSuffix(leftText, "\n") {
-				currentChapter.WriteString("\n")
+		for i, pagePath := range pagePaths {
+			client.SetImage(pagePath)
+			text, err := client.Text()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error performing OCR on %s (%s): %v\n", fileName, sides[i], err)
+				continue
 			}
-		}
-
-		// Process right page
-		client.SetImage(rightPath)
-		rightText, err := client.Text()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error performing OCR on %s (right): %v\n", fileName, err)
-		} else {
-			rightText = cleanText(rightText)
+			text = cleanText(text)
 
 			// Check if this is a new chapter start
-			if isChapterStart(rightText) {
-				fmt.Printf("\n📖 Chapter start detected: %s (right page) - %s\n", fileName, getFirstLine(rightText))
+			if isChapterStart(text) {
+				fmt.Printf("\n📖 Chapter start detected: %s (%s page) - %s\n", fileName, sides[i], getFirstLine(text))
 
 				// Process previous chapter if exists
 				if err := processChapter(); err != nil {
@@ -166,8 +185,8 @@ func main() {
 			}
 
 			// Add to current chapter
-			currentChapter.WriteString(rightText)
-			if !strings.HasSuffix(rightText, "\n") {
+			currentChapter.WriteString(text)
+			if !strings.HasSuffix(text, "\n") {
 				currentChapter.WriteString("\n")
 			}
 		}
@@ -191,7 +210,25 @@ func main() {
 	fmt.Printf("   Individual chapters saved as: chapter_01.md, chapter_02.md, etc.\n")
 }
 
-func cropAndSplitImage(inputPath, leftOutputPath, rightOutputPath string) error {
+// loadProfile looks up the named profile, falling back to the one the
+// captures were taken with.
+func loadProfile(name string, records []manifest.Record) (profile.Profile, error) {
+	if name == "" {
+		name = "kindle"
+		for i := len(records) - 1; i >= 0; i-- {
+			if records[i].Profile != "" {
+				name = records[i].Profile
+				break
+			}
+		}
+	}
+	return profile.Lookup(name)
+}
+
+// cropAndSplitImage cuts the top and bottom margins, fractions of the
+// height, off the image and splits it into len(outputPaths) pages of equal
+// width.
+func cropAndSplitImage(inputPath string, outputPaths []string, topMargin, bottomMargin float64) error {
 	// Open the image
 	file, err := os.Open(inputPath)
 	if err != nil {
@@ -199,8 +236,8 @@ func cropAndSplitImage(inputPath, leftOutputPath, rightOutputPath string) error
 	}
 	defer file.Close()
 
-	// Decode the image
-	img, err := png.Decode(file)
+	// Decode the image (format is detected from the file contents)
+	img, _, err := image.Decode(file)
 	if err != nil {
 		return fmt.Errorf("failed to decode image: %w", err)
 	}
@@ -215,45 +252,28 @@ func cropAndSplitImage(inputPath, leftOutputPath, rightOutputPath string) error
 	bottomCrop := int(float64(height) * bottomMargin)
 	croppedHeight := height - topCrop - bottomCrop
 
-	// Calculate middle point for splitting
-	middleX := width / 2
+	for i, outputPath := range outputPaths {
+		// Column of this page
+		left := width * i / len(outputPaths)
+		right := width * (i + 1) / len(outputPaths)
 
-	// Create left half image
-	leftImg := image.NewRGBA(image.Rect(0, 0, middleX, croppedHeight))
-	for y := topCrop; y < height-bottomCrop; y++ {
-		for x := 0; x < middleX; x++ {
-			leftImg.Set(x, y-topCrop, img.At(x, y))
+		pageImg := image.NewRGBA(image.Rect(0, 0, right-left, croppedHeight))
+		for y := topCrop; y < height-bottomCrop; y++ {
+			for x := left; x < right; x++ {
+				pageImg.Set(x-left, y-topCrop, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+			}
 		}
-	}
 
-	// Create right half image
-	rightImg := image.NewRGBA(image.Rect(0, 0, width-middleX, croppedHeight))
-	for y := topCrop; y < height-bottomCrop; y++ {
-		for x := middleX; x < width; x++ {
-			rightImg.Set(x-middleX, y-topCrop, img.At(x, y))
+		// Save the page
+		pageFile, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		err = png.Encode(pageFile, pageImg)
+		pageFile.Close()
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", filepath.Base(outputPath), err)
 		}
-	}
-
-	// Save left image
-	leftFile, err := os.Create(leftOutputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create left output file: %w", err)
-	}
-	defer leftFile.Close()
-
-	if err := png.Encode(leftFile, leftImg); err != nil {
-		return fmt.Errorf("failed to encode left image: %w", err)
-	}
-
-	// Save right image
-	rightFile, err := os.Create(rightOutputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create right output file: %w", err)
-	}
-	defer rightFile.Close()
-
-	if err := png.Encode(rightFile, rightImg); err != nil {
-		return fmt.Errorf("failed to encode right image: %w", err)
 	}
 
 	return nil
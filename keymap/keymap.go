@@ -0,0 +1,187 @@
+// Package keymap parses and validates the global hotkey bindings of the
+// capture tool.
+package keymap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Action is something a hotkey can trigger.
+type Action string
+
+const (
+	Capture Action = "capture" // Take a screenshot, or start auto mode
+	Undo    Action = "undo"    // Delete the most recent capture
+	Pause   Action = "pause"   // Pause or resume auto mode
+	Force   Action = "force"   // Capture and save even if it looks like a duplicate
+	Quit    Action = "quit"
+)
+
+// Actions lists every bindable action in display order.
+var Actions = []Action{Capture, Undo, Pause, Force, Quit}
+
+// Keymap maps each action to its chord, e.g. ["ctrl", "shift", "s"]. Actions
+// with an empty chord are unbound.
+type Keymap map[Action][]string
+
+// aliases are friendlier names for keys gohook knows under another name.
+var aliases = map[string]string{
+	"super":   "cmd",
+	"meta":    "cmd",
+	"win":     "cmd",
+	"command": "cmd",
+	"control": "ctrl",
+	"option":  "alt",
+	"escape":  "esc",
+	"return":  "enter",
+}
+
+var modifiers = map[string]bool{
+	"ctrl": true, "shift": true, "rshift": true,
+	"alt": true, "ralt": true, "cmd": true, "rcmd": true,
+}
+
+// Default returns the built-in bindings. macOS keeps the original Cmd-based
+// chords; other platforms have no Cmd key and use Ctrl instead.
+func Default(goos string) Keymap {
+	mod := "ctrl"
+	if goos == "darwin" {
+		mod = "cmd"
+	}
+	return Keymap{
+		Capture: {mod, "shift", "s"},
+		Undo:    {mod, "shift", "z"},
+		Pause:   {mod, "shift", "p"},
+		Force:   {mod, "shift", "f"},
+		Quit:    {mod, "shift", "q"},
+	}
+}
+
+// Parse applies a spec such as "capture=ctrl+alt+s,quit=" on top of base.
+// An empty chord unbinds the action.
+func Parse(spec string, base Keymap) (Keymap, error) {
+	km := Keymap{}
+	for action, chord := range base {
+		km[action] = chord
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, chord, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid binding %q (want action=key+key)", entry)
+		}
+
+		action := Action(strings.TrimSpace(name))
+		if !isAction(action) {
+			return nil, fmt.Errorf("unknown action %q (want one of %s)", action, actionNames())
+		}
+
+		km[action] = parseChord(chord)
+	}
+
+	return km, nil
+}
+
+func parseChord(chord string) []string {
+	var keys []string
+	for _, key := range strings.Split(chord, "+") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			continue
+		}
+		if alias, ok := aliases[key]; ok {
+			key = alias
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Validate checks every chord against the key names the hook library knows.
+// Chords must contain a non-modifier key, and no chord may be contained in
+// another: the hook fires every binding whose keys are all held down.
+func (km Keymap) Validate(known map[string]uint16) error {
+	for _, action := range Actions {
+		chord := km[action]
+		if len(chord) == 0 {
+			continue
+		}
+
+		hasKey := false
+		for _, key := range chord {
+			if _, ok := known[key]; !ok {
+				return fmt.Errorf("%s: cannot register %s: unknown key %q", action, Format(chord), key)
+			}
+			if !modifiers[key] {
+				hasKey = true
+			}
+		}
+		if !hasKey {
+			return fmt.Errorf("%s: cannot register %s: chord needs a non-modifier key", action, Format(chord))
+		}
+	}
+
+	for _, a := range Actions {
+		for _, b := range Actions {
+			if a == b || len(km[a]) == 0 || len(km[b]) == 0 {
+				continue
+			}
+			if contains(km[b], km[a]) {
+				return fmt.Errorf("%s (%s) would also trigger %s (%s)", b, Format(km[b]), a, Format(km[a]))
+			}
+		}
+	}
+
+	return nil
+}
+
+// contains reports whether every key of sub is in chord.
+func contains(chord, sub []string) bool {
+	for _, key := range sub {
+		found := false
+		for _, k := range chord {
+			if k == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Format renders a chord for display, e.g. "Ctrl+Shift+S".
+func Format(chord []string) string {
+	parts := make([]string, len(chord))
+	for i, key := range chord {
+		parts[i] = strings.ToUpper(key[:1]) + key[1:]
+	}
+	return strings.Join(parts, "+")
+}
+
+func isAction(a Action) bool {
+	for _, action := range Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func actionNames() string {
+	names := make([]string, len(Actions))
+	for i, a := range Actions {
+		names[i] = string(a)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,89 @@
+package keymap
+
+import (
+	"slices"
+	"testing"
+)
+
+// known stands in for gohook's key table
+var known = map[string]uint16{
+	"ctrl": 29, "shift": 42, "alt": 56, "cmd": 3675, "esc": 1, "enter": 28,
+	"s": 31, "z": 44, "p": 25, "f": 33, "q": 16, "x": 45, "f9": 67,
+}
+
+func TestDefault(t *testing.T) {
+	if got := Default("darwin")[Capture]; !slices.Equal(got, []string{"cmd", "shift", "s"}) {
+		t.Errorf("darwin capture = %v, want cmd+shift+s", got)
+	}
+	for _, goos := range []string{"linux", "windows", "darwin"} {
+		if err := Default(goos).Validate(known); err != nil {
+			t.Errorf("Default(%s) is invalid: %v", goos, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Keymap // Only the actions to check
+		ok   bool
+	}{
+		{"", Keymap{Capture: {"ctrl", "shift", "s"}}, true},
+		{"capture=ctrl+alt+s", Keymap{Capture: {"ctrl", "alt", "s"}, Undo: {"ctrl", "shift", "z"}}, true},
+		{" quit = , undo=F9 ", Keymap{Quit: nil, Undo: {"f9"}}, true},
+		{"capture=Control+Option+S", Keymap{Capture: {"ctrl", "alt", "s"}}, true},
+		{"pause=super+escape", Keymap{Pause: {"cmd", "esc"}}, true},
+		{"capture", nil, false},
+		{"snap=ctrl+s", nil, false},
+	}
+	for _, tt := range tests {
+		km, err := Parse(tt.spec, Default("linux"))
+		if (err == nil) != tt.ok {
+			t.Errorf("Parse(%q) error = %v, want ok %v", tt.spec, err, tt.ok)
+			continue
+		}
+		for action, chord := range tt.want {
+			if !slices.Equal(km[action], chord) {
+				t.Errorf("Parse(%q)[%s] = %v, want %v", tt.spec, action, km[action], chord)
+			}
+		}
+	}
+
+	// The base keymap is left alone
+	base := Default("linux")
+	Parse("capture=x", base)
+	if !slices.Equal(base[Capture], []string{"ctrl", "shift", "s"}) {
+		t.Errorf("Parse modified its base keymap: %v", base[Capture])
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		spec string
+		ok   bool
+	}{
+		{"", true},
+		{"quit=,undo=", true},
+		{"capture=f9", true},
+		{"capture=ctrl+shift+nosuchkey", false},
+		{"capture=ctrl+shift", false},               // Modifiers only
+		{"capture=ctrl+s,undo=ctrl+shift+s", false}, // Undo would also capture
+		{"capture=ctrl+shift+s,undo=ctrl+s", false}, // Capture would also undo
+		{"capture=ctrl+s,undo=ctrl+alt+z", true},
+	}
+	for _, tt := range tests {
+		km, err := Parse(tt.spec, Default("linux"))
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.spec, err)
+		}
+		if err := km.Validate(known); (err == nil) != tt.ok {
+			t.Errorf("Validate(%q) = %v, want ok %v", tt.spec, err, tt.ok)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	if got := Format([]string{"ctrl", "shift", "s"}); got != "Ctrl+Shift+S" {
+		t.Errorf("Format = %q, want Ctrl+Shift+S", got)
+	}
+}
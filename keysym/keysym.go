@@ -0,0 +1,50 @@
+// Package keysym maps the key names used for page turning (robotgo's names,
+// such as "right" or "pagedown") to X11 keysyms, which both RFB key events
+// and XTEST speak.
+package keysym
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var named = map[string]uint32{
+	"backspace": 0xff08,
+	"tab":       0xff09,
+	"enter":     0xff0d,
+	"escape":    0xff1b,
+	"esc":       0xff1b,
+	"space":     0x0020,
+	"delete":    0xffff,
+	"home":      0xff50,
+	"left":      0xff51,
+	"up":        0xff52,
+	"right":     0xff53,
+	"down":      0xff54,
+	"pageup":    0xff55,
+	"pagedown":  0xff56,
+	"end":       0xff57,
+	"insert":    0xff63,
+	"shift":     0xffe1,
+	"ctrl":      0xffe3,
+	"alt":       0xffe9,
+	"cmd":       0xffeb, // Super
+}
+
+// Lookup returns the keysym for a key name, or for a single Latin-1
+// character such as "n" or ".".
+func Lookup(name string) (uint32, error) {
+	if sym, ok := named[strings.ToLower(name)]; ok {
+		return sym, nil
+	}
+	if r, size := utf8.DecodeRuneInString(name); size == len(name) && r >= 0x20 && r <= 0xff {
+		return uint32(r), nil
+	}
+	// F1-F12
+	var n int
+	if _, err := fmt.Sscanf(strings.ToLower(name), "f%d", &n); err == nil && n >= 1 && n <= 12 && name[1:] == fmt.Sprint(n) {
+		return 0xffbe + uint32(n-1), nil
+	}
+	return 0, fmt.Errorf("unknown key %q", name)
+}
@@ -0,0 +1,40 @@
+package keysym
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name string
+		want uint32
+	}{
+		{"right", 0xff53},
+		{"PageDown", 0xff56},
+		{"esc", 0xff1b},
+		{"space", 0x0020},
+		{"F1", 0xffbe},
+		{"f5", 0xffc2},
+		{"F12", 0xffc9},
+		{"n", 'n'},
+		{"N", 'N'},
+		{".", '.'},
+		{"f", 'f'},
+		{"é", 0xe9},
+		{"ÿ", 0xff},
+	}
+	for _, tt := range tests {
+		got, err := Lookup(tt.name)
+		if err != nil {
+			t.Errorf("Lookup(%q): %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Lookup(%q) = %#x, want %#x", tt.name, got, tt.want)
+		}
+	}
+
+	for _, name := range []string{"", "F0", "F13", "F01", "F1x", "nosuchkey", "€", "\t", "ab"} {
+		if got, err := Lookup(name); err == nil {
+			t.Errorf("Lookup(%q) = %#x, want error", name, got)
+		}
+	}
+}
@@ -1,253 +1,1068 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"image"
-	"image/png"
-	"math"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"strconv"
+	"os/signal"
+	"regexp"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	// "github.com/go-vgo/robotgo"
+	"github.com/go-vgo/robotgo"
 	hook "github.com/robotn/gohook"
-	"github.com/kbinani/screenshot"
+
+	"screenshot-capture/analyze"
+	"screenshot-capture/capture"
+	"screenshot-capture/codec"
+	"screenshot-capture/control"
+	"screenshot-capture/keymap"
+	"screenshot-capture/notify"
+	"screenshot-capture/phash"
+	"screenshot-capture/pipeline"
+	"screenshot-capture/profile"
+	"screenshot-capture/reject"
+	"screenshot-capture/session"
+	"screenshot-capture/settle"
+	"screenshot-capture/similarity"
+	"screenshot-capture/turn"
+	"screenshot-capture/vnc"
+	"screenshot-capture/window"
 )
 
-const (
-	screenshotDir = "screenshots"
-	// Similarity threshold: 0.0 = identical, 1.0 = completely different
-	// Adjust this value based on testing (higher = more tolerant of differences)
-	similarityThreshold = 0.01
+// Similarity threshold: 0.0 = identical, 1.0 = completely different
+// Set by the profile (higher = more tolerant of differences)
+var similarityThreshold float64
+
+var screenshotDir = "screenshots"
+
+// captures runs every capture through dedup and saving
+var captures *pipeline.Pipeline
+
+// Session provenance: every capture attempt is appended to the manifest
+var (
+	sessionStart = time.Now()
+	sessionID    = sessionStart.Format("20060102-150405")
 )
 
-var lastScreenshot *image.RGBA
+// Resuming continues the last session in the capture directory
+var (
+	resume      bool
+	sessionArgs []string // Flags the session was started with, saved for -resume
+)
+
+// Saves are encoded and written by worker goroutines, so a slow encoder or
+// disk never holds up the hotkeys
+var (
+	workerCount int
+	queueSize   int
+)
+
+// capturer is the page source: the live screen, or a replay of old captures
+var capturer capture.Capturer
+
+// Perceptual-hash dedup against every page saved in the session
+var (
+	hashFunc     func(image.Image) phash.Hash
+	hashDistance int
+)
+
+// readerProfile holds the settings of the reader app being captured
+var readerProfile profile.Profile
+
+// target selects the reader window; its Name doubles as the file prefix
+var target window.Matcher
+
+// Calibration of the content area inside the target window
+var (
+	calibrate       bool
+	calibrationFile string
+	calibrated      bool // Calibrated insets trim the window chrome off captures
+)
+
+// hashAlgo names the perceptual hash stored in the index
+var hashAlgo string
+
+// Frames flagged by a classifier are never saved; live captures are retried
+// a few times first since loading screens clear up by themselves
+var (
+	classifiers   []reject.Classifier
+	rejectRetries int
+	rejectWait    time.Duration
+)
+
+// notifier gives feedback after every capture
+var notifier notify.Notifier
+
+// pageTurner advances the reader to the next page in auto mode
+var pageTurner turn.PageTurner
+
+// encoding is the storage format of saved captures
+var encoding codec.Options
+
+// pagePadding is the minimum number of digits in capture file numbers
+var pagePadding int
+
+// autoConfig controls unattended paging through a book.
+type autoConfig struct {
+	enabled  bool
+	nextKey  string        // key that turns the page, for key page turns
+	delay    time.Duration // wait after the key press before checking the page
+	maxPages int           // stop after this many saved pages (0 = no limit)
+	endAfter int           // consecutive duplicates that mean the book has ended
+
+	// Page-turn verification: after the key press, poll until the frame
+	// differs from the previous page and then holds still
+	verify       bool
+	pollInterval time.Duration
+	stableFrames int           // consecutive similar polls that count as settled
+	turnTimeout  time.Duration // per key press
+	turnRetries  int           // extra key presses before giving up
+}
+
+var (
+	auto        autoConfig
+	autoRunning atomic.Bool
+	autoPaused  atomic.Bool
+	autoStop    atomic.Bool // Ends auto capture before the next page
+)
+
+// watchConfig controls capturing pages the user turns by hand.
+type watchConfig struct {
+	enabled      bool
+	interval     time.Duration // how often the capture region is sampled
+	stableFrames int           // consecutive unchanged samples that mean the page has settled
+	minGap       time.Duration // minimum time between two watch captures
+}
+
+var (
+	watch       watchConfig
+	watchPaused atomic.Bool
+)
+
+// listenAddr is the address of the HTTP control API; empty disables it
+var listenAddr string
+
+// listenToken must be sent with every control API request; generated if empty
+var listenToken string
+
+// keys holds the hotkey chord of every action
+var keys keymap.Keymap
 
 func main() {
-	// Create screenshots directory if it doesn't exist
-	if err := os.MkdirAll(screenshotDir, 0755); err != nil {
-		fmt.Printf("Error creating directory: %v\n", err)
+	if len(os.Args) > 1 && os.Args[1] == "analyze" {
+		if err := runAnalyze(os.Args[2:]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := parseFlags(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	if calibrate {
+		runCalibration()
+		return
+	}
+
+	var err error
+	captures, err = pipeline.New(pipeline.Config{
+		Dir:           screenshotDir,
+		Session:       sessionID,
+		Profile:       readerProfile.Name,
+		Source:        capturer,
+		Prefix:        target.Name,
+		Threshold:     similarityThreshold,
+		HashAlgo:      hashAlgo,
+		HashDistance:  hashDistance,
+		Encoding:      encoding,
+		Padding:       pagePadding,
+		Classifiers:   classifiers,
+		RejectRetries: rejectRetries,
+		RejectWait:    rejectWait,
+		Calibrated:    calibrated,
+		Notifier:      notifier,
+		Workers:       workerCount,
+		QueueSize:     queueSize,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	defer captures.Close()
+
+	if resume {
+		captures.Resume()
+	}
+
+	quit := make(chan struct{})
+	var quitOnce sync.Once
+	stop := func() {
+		quitOnce.Do(func() {
+			captures.Stop()
+			close(quit)
+		})
+	}
+
+	// Ctrl+C and SIGTERM let queued saves finish; a second signal kills
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		fmt.Printf("Received %v, finishing pending saves (repeat to abort)\n", sig)
+		stop()
+	}()
+
+	// A replay runs headless through every saved frame and exits
+	if replay, ok := capturer.(*capture.Replay); ok {
+		defer replay.Close()
+		runReplay()
 		return
 	}
 
 	fmt.Println("Screenshot capture app started!")
-	fmt.Println("Press Cmd+Shift+S to take a screenshot")
+	fmt.Printf("Using the %s profile\n", readerProfile.Name)
+
+	state := session.State{ID: sessionID, Profile: readerProfile.Name, Started: sessionStart, Args: sessionArgs}
+	if err := session.Save(screenshotDir, state); err != nil {
+		fmt.Printf("Error saving session state, -resume will not work: %v\n", err)
+	}
+
+	if listenAddr != "" {
+		if listenToken == "" {
+			listenToken = control.NewToken()
+		}
+		server, err := control.Serve(listenAddr, listenToken, controller{})
+		if err != nil {
+			fmt.Printf("Error starting control API: %v\n", err)
+			return
+		}
+		defer server.Close()
+		fmt.Printf("Control API listening on http://%s (send %s: %s)\n", listenAddr, control.TokenHeader, listenToken)
+	}
+
+	handlers := map[keymap.Action]func(){
+		keymap.Capture: func() {
+			if auto.enabled {
+				if err := startAutoCapture(); err != nil {
+					fmt.Printf("%v\n", err)
+				}
+				return
+			}
+			captures.Capture(false)
+		},
+		keymap.Undo:  undoLastCapture,
+		keymap.Pause: toggleAutoPause,
+		keymap.Force: func() {
+			fmt.Println("Forcing capture, similarity checks disabled")
+			captures.Capture(true)
+		},
+		keymap.Quit: stop,
+	}
+	if watch.enabled {
+		handlers[keymap.Pause] = toggleWatchPause
+	}
+
+	// Hotkeys run one at a time, in order, off the hook's event loop
+	actions := make(chan keymap.Action, 8)
+	go func() {
+		for action := range actions {
+			handlers[action]()
+		}
+	}()
+
+	// Register global hotkeys using gohook
+	for _, action := range keymap.Actions {
+		chord, handler := keys[action], handlers[action]
+		if len(chord) == 0 || handler == nil {
+			continue
+		}
+
+		fmt.Printf("Press %s to %s\n", keymap.Format(chord), actionDescription(action))
+		hook.Register(hook.KeyDown, chord, func(e hook.Event) {
+			fmt.Printf("Hotkey triggered: %s\n", action)
+			if action == keymap.Quit {
+				handler()
+				return
+			}
+			select {
+			case actions <- action:
+			default:
+				fmt.Printf("Still busy, ignoring %s\n", action)
+			}
+		})
+	}
 	fmt.Println("Press Ctrl+C to quit")
 
-	// Register global hotkey using gohook
-	// Cmd+Shift+S (keys "cmd", "shift", "s")
-	hook.Register(hook.KeyDown, []string{"cmd", "shift", "s"}, func(e hook.Event) {
-		fmt.Println("Hotkey triggered!")
-		handleScreenshot()
-	})
+	if watch.enabled {
+		go runWatch()
+	}
 
+	// Returning from main tears the hook down with the process
 	s := hook.Start()
-	<-hook.Process(s)
+	select {
+	case <-hook.Process(s):
+	case <-quit:
+		fmt.Println("Quitting...")
+	}
 }
 
-func handleScreenshot() {
-	// Capture screenshot first
-	var img *image.RGBA
-	if !captureKindleWindow(&img) {
-		captureFullScreen(&img)
+// runAnalyze is the analyze subcommand: it runs the similarity metric over
+// saved captures and recommends a threshold that separates page turns from
+// re-captures.
+func runAnalyze(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	dir := fs.String("dir", screenshotDir, "directory of captures to analyze")
+	all := fs.Bool("all", false, "compare every pair of captures, not just consecutive ones")
+	csvFile := fs.String("csv", "", "write the diff of every pair to this CSV file")
+	profileName := fs.String("profile", "kindle", "profile whose threshold to compare against")
+	fs.Parse(args)
+
+	current, err := profile.Lookup(*profileName)
+	if err != nil {
+		return err
 	}
 
-	if img == nil {
-		fmt.Println("Failed to capture screenshot")
-		return
+	names, samples, err := analyze.Load(*dir)
+	if err != nil {
+		return err
+	}
+	if len(names) < 2 {
+		return fmt.Errorf("need at least two captures in %s, found %d", *dir, len(names))
 	}
 
-	// Check if similar to last screenshot
-	if lastScreenshot != nil && isSimilar(lastScreenshot, img) {
-		fmt.Println("Screenshot is similar to previous one, skipping...")
-		// Still press right arrow to advance
-		// robotgo.KeyTap("right")
-		return
+	pairs := analyze.Consecutive(names, samples)
+	if *all {
+		pairs = analyze.All(names, samples)
 	}
+	fmt.Printf("Compared %d pairs of %d captures in %s\n\n", len(pairs), len(names), *dir)
 
-	// Play sound
-	playSound()
+	rec, _ := analyze.Recommend(pairs)
+	outliers := analyze.MarkOutliers(pairs, rec.Threshold)
 
-	// Save the screenshot
-	saveScreenshotImg(img)
+	// Histogram, trimmed to the buckets in use
+	bins := analyze.Histogram(pairs)
+	first, last, most := len(bins), 0, 0
+	for i, bin := range bins {
+		if bin.Count > 0 {
+			first, last, most = min(first, i), i, max(most, bin.Count)
+		}
+	}
+	fmt.Println("Diff ratio        Pairs")
+	for _, bin := range bins[first : last+1] {
+		bar := strings.Repeat("#", (bin.Count*50+most-1)/most)
+		var marks []string
+		if current.Threshold >= bin.Min && current.Threshold < bin.Max {
+			marks = append(marks, "current threshold")
+		}
+		if rec.Threshold >= bin.Min && rec.Threshold < bin.Max {
+			marks = append(marks, "recommended")
+		}
+		note := ""
+		if len(marks) > 0 {
+			note = "  <- " + strings.Join(marks, ", ")
+		}
+		fmt.Printf("%-8.2g-%8.2g %6d %s%s\n", bin.Min, bin.Max, bin.Count, bar, note)
+	}
 
-	// Store as last screenshot
-	lastScreenshot = img
+	if outliers > 0 {
+		fmt.Printf("\n%d outliers:\n", outliers)
+		for _, p := range pairs {
+			if p.Outlier {
+				fmt.Printf("  %s vs %s: %.4f\n", p.A, p.B, p.Diff)
+			}
+		}
+	}
 
-	// Press right arrow key to go to next page
-	// robotgo.KeyTap("right")
-	// fmt.Println("Pressed right arrow key")
-}
+	fmt.Println()
+	if rec.Separation < 3 {
+		fmt.Println("No clear gap between re-captures and page turns; these all look like page turns.")
+		fmt.Printf("Recommended -threshold %.4f (half the smallest diff), current %s threshold %.4f\n",
+			rec.Threshold, current.Name, current.Threshold)
+	} else {
+		fmt.Printf("Recommended -threshold %.4f, current %s threshold %.4f\n", rec.Threshold, current.Name, current.Threshold)
+		fmt.Printf("%d of %d pairs fall below it as re-captures; the gap spans a factor of %.1f\n",
+			rec.Below, len(pairs), rec.Separation)
+	}
 
-func playSound() {
-	// Play system beep sound
-	go func() {
-		exec.Command("afplay", "/System/Library/Sounds/Glass.aiff").Run()
-	}()
+	if *csvFile != "" {
+		file, err := os.Create(*csvFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := analyze.WriteCSV(file, pairs); err != nil {
+			return fmt.Errorf("failed to write %s: %w", *csvFile, err)
+		}
+		fmt.Printf("Wrote %d pairs to %s\n", len(pairs), *csvFile)
+	}
+	return nil
 }
 
-func isSimilar(img1, img2 *image.RGBA) bool {
-	// Check if dimensions match
-	if img1.Bounds() != img2.Bounds() {
-		return false
+// runCalibration asks the user to point at two corners of the page content
+// and saves them as insets from the target window's edges, so captures and
+// similarity checks leave out toolbars and footers.
+func runCalibration() {
+	chord := keys[keymap.Capture]
+	prompts := []string{"top-left", "bottom-right"}
+	var corners []image.Point
+	done := make(chan struct{})
+
+	fmt.Printf("Calibrating %s: hover over the %s corner of the page content and press %s\n",
+		target.Name, prompts[0], keymap.Format(chord))
+
+	hook.Register(hook.KeyDown, chord, func(e hook.Event) {
+		if len(corners) == len(prompts) {
+			return
+		}
+		x, y := robotgo.Location()
+		corners = append(corners, image.Pt(x, y))
+		fmt.Printf("Marked %s corner at (%d,%d)\n", prompts[len(corners)-1], x, y)
+
+		if len(corners) < len(prompts) {
+			fmt.Printf("Now hover over the %s corner and press %s\n", prompts[len(corners)], keymap.Format(chord))
+			return
+		}
+		close(done)
+	})
+
+	s := hook.Start()
+	select {
+	case <-hook.Process(s):
+		return
+	case <-done:
+	}
+
+	win, err := window.Find(target)
+	if err != nil {
+		fmt.Printf("Calibration failed: %s window not found: %v\n", target.Name, err)
+		return
+	}
+
+	content := image.Rectangle{Min: corners[0], Max: corners[1]}.Canon()
+	insets, err := window.InsetsBetween(win.Bounds, content)
+	if err != nil {
+		fmt.Printf("Calibration failed: %v\n", err)
+		return
+	}
+
+	if err := window.SaveCalibration(calibrationFile, target.Name, insets); err != nil {
+		fmt.Printf("Calibration failed: %v\n", err)
+		return
 	}
+	fmt.Printf("Saved %s content area to %s: top %d, right %d, bottom %d, left %d pixels from the window edges\n",
+		target.Name, calibrationFile, insets.Top, insets.Right, insets.Bottom, insets.Left)
+}
 
-	bounds := img1.Bounds()
+func actionDescription(action keymap.Action) string {
+	switch action {
+	case keymap.Capture:
+		if auto.enabled {
+			return "start auto capture"
+		}
+		return "take a screenshot"
+	case keymap.Undo:
+		return "undo the last capture"
+	case keymap.Pause:
+		if watch.enabled {
+			return "pause/resume watching for page changes"
+		}
+		return "pause/resume auto capture"
+	case keymap.Force:
+		return "save a capture even if it looks like a duplicate"
+	case keymap.Quit:
+		return "quit"
+	}
+	return string(action)
+}
 
-	// Sample-based comparison for performance
-	// Compare every 10th pixel to speed up comparison
-	sampleRate := 10
-	totalSamples := 0
-	differentPixels := 0
+func parseFlags() error {
+	profileName := flag.String("profile", "kindle", "reader app profile, also used as the file prefix: "+strings.Join(profile.Names(), ", "))
+	owner := flag.String("owner", "", "match windows whose owner/app name contains this (case-insensitive; default from -profile)")
+	title := flag.String("title", "", "match windows whose title matches this regular expression (default from -profile)")
+	pid := flag.Int("pid", 0, "match windows owned by this process ID")
+	minSize := flag.String("min-size", "", "ignore windows smaller than WIDTHxHEIGHT")
+	pick := flag.String("pick", "frontmost", "which matching window to use: frontmost, largest or nth:N")
+	keySpec := flag.String("keys", "", "hotkey overrides such as \"capture=ctrl+alt+s,quit=\" (actions: capture, undo, pause, force, quit)")
+	flag.StringVar(&screenshotDir, "dir", screenshotDir, "directory captures are saved to")
+	flag.BoolVar(&calibrate, "calibrate", false, "mark the page content area of the target window with the mouse, save it and exit")
+	flag.StringVar(&calibrationFile, "calibration", "calibration.json", "file holding the calibrated content area of each profile")
+	displaySpec := flag.String("display", "auto", "display to search and fall back to: auto, an index, or WIDTHxHEIGHT+X+Y")
+	scale := flag.Float64("scale", 0, "physical pixels per window coordinate unit, e.g. 2 on Retina (0 = detect per display)")
+	targetDPI := flag.Int("target-dpi", 0, "downsample sharper captures to this DPI, where scale 1 is 96 DPI (0 = full resolution)")
+	captureCmd := flag.String("capture-cmd", "", "capture by running this shell command, which must write a PNG/JPEG/WebP image to stdout (e.g. \"grim -\")")
+	captureTimeout := flag.Duration("capture-timeout", 10*time.Second, "kill -capture-cmd if it runs longer than this")
+	vncAddr := flag.String("vnc", "", "capture from this VNC server (host:port) and send page turns to it")
+	vncPassword := flag.String("vnc-password", "", "VNC password (default $VNC_PASSWORD)")
+	replaySource := flag.String("replay", "", "replay images from this directory or .zip archive instead of capturing the screen")
+	flag.StringVar(&encoding.Format, "format", codec.PNG, "storage format: png, gray, palette, jpeg, webp or webp-lossless")
+	flag.IntVar(&encoding.Quality, "quality", 90, "quality (1-100) for jpeg and webp")
+	flag.IntVar(&encoding.Colors, "colors", 256, "palette size (2-256) for the palette format")
+	flag.IntVar(&pagePadding, "pad", 3, "zero-pad capture numbers to this many digits")
+	flag.IntVar(&workerCount, "save-workers", 2, "number of goroutines encoding and writing captures")
+	flag.IntVar(&queueSize, "save-queue", 8, "captures that may wait to be written before capturing blocks")
+	turnSpec := flag.String("turn", "key", "how auto mode turns pages: key (over VNC with -vnc), xtest, command, click:X,Y or none")
+	turnCmd := flag.String("turn-cmd", "", "command for -turn command, e.g. \"xdotool key Right\" or \"adb shell input keyevent 22\"")
+	notifySpec := flag.String("notify", "auto", "capture feedback: auto, bell, desktop, command or none")
+	notifyCmd := flag.String("notify-cmd", "", "command for -notify command; {event} becomes saved, skipped or failed")
+	minInk := flag.Float64("min-ink", 0.002, "reject frames where less than this fraction of pixels stands out from the background (0 disables)")
+	overlayDir := flag.String("overlay-dir", "", "directory of reference images of dialogs/overlays whose frames are rejected")
+	overlayDiff := flag.Float64("overlay-diff", 12, "max mean luminance difference (0-255) for an overlay template to match")
+	flag.IntVar(&rejectRetries, "reject-retries", 2, "times to recapture a rejected frame before giving up on it")
+	flag.DurationVar(&rejectWait, "reject-wait", time.Second, "wait before recapturing a rejected frame")
+	flag.StringVar(&hashAlgo, "hash", "dhash", "perceptual hash used for dedup: dhash or phash")
+	flag.IntVar(&hashDistance, "hash-distance", 10, "max Hamming distance (of 256 bits) for a page to count as already captured, if its pixels match too")
+	flag.StringVar(&listenAddr, "listen", "", "serve the HTTP control API on this loopback address, e.g. 127.0.0.1:8765")
+	flag.StringVar(&listenToken, "listen-token", "", "token control API clients send in the X-Capture-Token header (default: random per session)")
+	flag.BoolVar(&auto.enabled, "auto", false, "page through the book automatically once the hotkey is pressed")
+	flag.StringVar(&auto.nextKey, "next-key", "", "key that turns to the next page in auto mode (default from -profile)")
+	flag.DurationVar(&auto.delay, "delay", 0, "wait after turning the page before capturing (default from -profile)")
+	flag.Float64Var(&similarityThreshold, "threshold", 0, "different-pixel ratio below which two captures count as the same page (default from -profile)")
+	flag.IntVar(&auto.maxPages, "max-pages", 0, "stop auto mode after saving this many pages (0 = no limit)")
+	flag.IntVar(&auto.endAfter, "end-after", 3, "stop auto mode after this many consecutive duplicate captures")
+	flag.BoolVar(&auto.verify, "verify-turn", true, "in auto mode, wait for the page to change and settle before capturing")
+	flag.DurationVar(&auto.pollInterval, "settle-interval", 150*time.Millisecond, "how often to sample the page while waiting for it to settle")
+	flag.IntVar(&auto.stableFrames, "stable-frames", 2, "consecutive unchanged samples that mean the page has settled")
+	flag.DurationVar(&auto.turnTimeout, "turn-timeout", 5*time.Second, "how long to wait for the page to change after a key press")
+	flag.IntVar(&auto.turnRetries, "turn-retries", 2, "times to press the next-page key again when the page doesn't change")
+	flag.BoolVar(&watch.enabled, "watch", false, "capture automatically whenever the page changes and then settles, for paging by hand")
+	flag.DurationVar(&watch.interval, "watch-interval", 250*time.Millisecond, "how often to sample the page in watch mode")
+	flag.IntVar(&watch.stableFrames, "watch-stable", 3, "consecutive unchanged samples that mean a new page has settled in watch mode")
+	flag.DurationVar(&watch.minGap, "watch-min-gap", time.Second, "minimum time between two captures in watch mode")
+	flag.BoolVar(&resume, "resume", false, "continue the last session in -dir with its settings; flags given now still override them")
+	flag.Parse()
 
-	for y := bounds.Min.Y; y < bounds.Max.Y; y += sampleRate {
-		for x := bounds.Min.X; x < bounds.Max.X; x += sampleRate {
-			totalSamples++
+	if resume {
+		if err := restoreSessionFlags(); err != nil {
+			return err
+		}
+	}
 
-			r1, g1, b1, _ := img1.At(x, y).RGBA()
-			r2, g2, b2, _ := img2.At(x, y).RGBA()
+	// Remember the settings so that -resume can restore them, except for
+	// one-off modes and secrets
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "resume", "calibrate", "replay", "vnc-password", "listen-token":
+			return
+		}
+		sessionArgs = append(sessionArgs, "-"+f.Name+"="+f.Value.String())
+	})
 
-			// Calculate color difference (Euclidean distance in RGB space)
-			// Normalize to 0-255 range
-			dr := float64(r1>>8) - float64(r2>>8)
-			dg := float64(g1>>8) - float64(g2>>8)
-			db := float64(b1>>8) - float64(b2>>8)
+	var err error
+	if readerProfile, err = profile.Lookup(*profileName); err != nil {
+		return fmt.Errorf("invalid -profile: %w", err)
+	}
+	if target, err = readerProfile.Matcher(); err != nil {
+		return err
+	}
+	target.PID = *pid
 
-			distance := math.Sqrt(dr*dr + dg*dg + db*db)
+	// Flags given on the command line override the profile
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
 
-			// If color difference > threshold, count as different
-			if distance > 30 { // Threshold for individual pixel difference
-				differentPixels++
+	if set["owner"] {
+		target.Owner = *owner
+	}
+	if set["title"] {
+		target.Title = nil
+		if *title != "" {
+			re, err := regexp.Compile(*title)
+			if err != nil {
+				return fmt.Errorf("invalid -title pattern: %w", err)
 			}
+			target.Title = re
 		}
 	}
+	if !set["next-key"] {
+		auto.nextKey = readerProfile.NextKey
+	}
+	if !set["delay"] {
+		auto.delay = readerProfile.Delay
+	}
+	if !set["threshold"] {
+		similarityThreshold = readerProfile.Threshold
+	}
 
-	// Calculate percentage of different pixels
-	diffRatio := float64(differentPixels) / float64(totalSamples)
+	if target.MinWidth, target.MinHeight, err = window.ParseSize(*minSize); err != nil {
+		return fmt.Errorf("invalid -min-size: %w", err)
+	}
+	if target.Pick, target.Nth, err = window.ParsePick(*pick); err != nil {
+		return fmt.Errorf("invalid -pick: %w", err)
+	}
 
-	fmt.Printf("Similarity check: %.2f%% different pixels\n", diffRatio*100)
+	sources := 0
+	for _, source := range []string{*replaySource, *captureCmd, *vncAddr} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("only one of -replay, -capture-cmd and -vnc can be used")
+	}
 
-	return diffRatio < similarityThreshold
-}
+	if *replaySource != "" {
+		if capturer, err = capture.NewReplay(*replaySource); err != nil {
+			return err
+		}
+	} else if *captureCmd != "" {
+		capturer = &capture.Command{Line: *captureCmd, Timeout: *captureTimeout}
+	} else if *vncAddr != "" {
+		password := *vncPassword
+		if password == "" {
+			password = os.Getenv("VNC_PASSWORD")
+		}
+		client, err := vnc.Dial(*vncAddr, password, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		name, bounds := client.Desktop()
+		fmt.Printf("Connected to VNC desktop %q (%dx%d)\n", name, bounds.Dx(), bounds.Dy())
+		capturer = client
+	} else {
+		// An empty matcher would pick whatever is frontmost, usually the
+		// terminal running this tool
+		if target.Owner == "" && target.Title == nil && target.PID == 0 {
+			return fmt.Errorf("the %s profile matches any window; name the reader with -owner, -title or -pid", readerProfile.Name)
+		}
+		display, err := capture.ParseDisplay(*displaySpec, capture.Displays())
+		if err != nil {
+			return fmt.Errorf("invalid -display: %w", err)
+		}
+		insets, err := window.LoadCalibration(calibrationFile, target.Name)
+		if err != nil {
+			return err
+		}
+		calibrated = insets != (window.Insets{})
+		if !calibrated {
+			insets = readerProfile.Insets
+		}
+		if *scale < 0 || *targetDPI < 0 {
+			return fmt.Errorf("-scale and -target-dpi must not be negative")
+		}
+		capturer = &capture.Screen{Target: target, Display: display, Insets: insets, Scale: *scale, TargetDPI: *targetDPI}
+	}
 
-func captureKindleWindow(imgOut **image.RGBA) bool {
-	// Use screencapture with window selection for Kindle
-	// First try to use macOS screencapture with window ID
+	if pagePadding < 1 || pagePadding > 9 {
+		return fmt.Errorf("-pad must be between 1 and 9")
+	}
 
-	// Get window ID using Python script (more reliable than AppleScript for Kindle)
-	cmd := exec.Command("python3", "-c", `
-import Quartz
-import sys
+	if workerCount < 1 || queueSize < 1 {
+		return fmt.Errorf("-save-workers and -save-queue must be at least 1")
+	}
 
-window_list = Quartz.CGWindowListCopyWindowInfo(
-    Quartz.kCGWindowListOptionOnScreenOnly | Quartz.kCGWindowListExcludeDesktopElements,
-    Quartz.kCGNullWindowID
-)
+	if err := encoding.Validate(); err != nil {
+		return fmt.Errorf("invalid output encoding: %w", err)
+	}
 
-for window in window_list:
-    owner = window.get('kCGWindowOwnerName', '')
-    if 'Kindle' in owner:
-        bounds = window['kCGWindowBounds']
-        wid = window['kCGWindowNumber']
-        print(f"{int(bounds['X'])},{int(bounds['Y'])},{int(bounds['Width'])},{int(bounds['Height'])},{wid}")
-        sys.exit(0)
-sys.exit(1)
-`)
-
-	output, err := cmd.Output()
-	if err != nil {
-		fmt.Println("Kindle window not found, capturing full screen instead")
-		return false
+	if *minInk > 0 {
+		classifiers = append(classifiers, reject.Blank{MinInk: *minInk})
+	}
+	if *overlayDir != "" {
+		templates, err := reject.LoadTemplates(*overlayDir)
+		if err != nil {
+			return fmt.Errorf("invalid -overlay-dir: %w", err)
+		}
+		classifiers = append(classifiers, reject.Overlay{Templates: templates, MaxDiff: *overlayDiff})
 	}
 
-	// Parse window bounds and ID
-	parts := strings.Split(strings.TrimSpace(string(output)), ",")
-	if len(parts) != 5 {
-		fmt.Printf("Invalid output format: %s\n", string(output))
-		return false
+	if notifier, err = newNotifier(*notifySpec, *notifyCmd); err != nil {
+		return fmt.Errorf("invalid -notify: %w", err)
 	}
 
-	x, _ := strconv.Atoi(parts[0])
-	y, _ := strconv.Atoi(parts[1])
-	w, _ := strconv.Atoi(parts[2])
-	h, _ := strconv.Atoi(parts[3])
+	// Keys and clicks go to the VNC desktop when capturing from one
+	client, _ := capturer.(*vnc.Client)
+	if pageTurner, err = turn.Parse(*turnSpec, auto.nextKey, *turnCmd, client); err != nil {
+		return fmt.Errorf("invalid -turn: %w", err)
+	}
 
-	fmt.Printf("Capturing Kindle window at (%d,%d) size %dx%d\n", x, y, w, h)
+	if hashFunc, err = phash.Func(hashAlgo); err != nil {
+		return fmt.Errorf("invalid -hash: %w", err)
+	}
 
-	// Capture the specific region
-	img, err := screenshot.CaptureRect(image.Rect(x, y, x+w, y+h))
-	if err != nil {
-		fmt.Printf("Error capturing Kindle window: %v\n", err)
-		return false
+	if keys, err = keymap.Parse(*keySpec, keymap.Default(runtime.GOOS)); err != nil {
+		return fmt.Errorf("invalid -keys: %w", err)
+	}
+	if err := keys.Validate(hook.Keycode); err != nil {
+		return fmt.Errorf("invalid hotkeys: %w", err)
+	}
+
+	if auto.endAfter < 1 {
+		return fmt.Errorf("-end-after must be at least 1")
+	}
+	if auto.stableFrames < 1 || auto.turnRetries < 0 {
+		return fmt.Errorf("-stable-frames must be at least 1 and -turn-retries not negative")
 	}
 
-	*imgOut = img
-	return true
+	if watch.enabled {
+		if auto.enabled || *replaySource != "" {
+			return fmt.Errorf("-watch cannot be combined with -auto or -replay")
+		}
+		if watch.interval <= 0 || watch.stableFrames < 1 {
+			return fmt.Errorf("-watch-interval must be positive and -watch-stable at least 1")
+		}
+	}
+
+	return nil
 }
 
-func captureFullScreen(imgOut **image.RGBA) {
-	// Capture the primary display
-	bounds := screenshot.GetDisplayBounds(0)
-	img, err := screenshot.CaptureRect(bounds)
+// restoreSessionFlags applies the flags of the session being resumed, then
+// the command line again so that it takes precedence.
+func restoreSessionFlags() error {
+	state, found, err := session.Load(screenshotDir)
 	if err != nil {
-		fmt.Printf("Error capturing screenshot: %v\n", err)
-		return
+		return err
+	}
+	if !found {
+		fmt.Printf("No session to resume in %s, starting a new one\n", screenshotDir)
+		resume = false
+		return nil
+	}
+
+	if err := flag.CommandLine.Parse(state.Args); err != nil {
+		return fmt.Errorf("invalid flags in %s: %w", session.File, err)
+	}
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		return err
 	}
 
-	fmt.Println("Captured full screen")
-	*imgOut = img
+	sessionID, sessionStart = state.ID, state.Started
+	fmt.Printf("Resuming session %s (%s profile, started %s)\n", state.ID, state.Profile, state.Started.Format(time.DateTime))
+	return nil
 }
 
-func saveScreenshotImg(img *image.RGBA) {
-	// Determine prefix based on image size (Kindle window vs full screen)
-	prefix := "screen"
-	bounds := screenshot.GetDisplayBounds(0)
-	if img.Bounds().Dx() < bounds.Dx() || img.Bounds().Dy() < bounds.Dy() {
-		prefix = "kindle"
+func newNotifier(spec, command string) (notify.Notifier, error) {
+	switch spec {
+	case "auto":
+		// Keep the familiar macOS sounds, other platforms get the bell
+		if runtime.GOOS == "darwin" {
+			return notify.SystemSounds(), nil
+		}
+		return notify.Bell{W: os.Stdout}, nil
+	case "bell":
+		return notify.Bell{W: os.Stdout}, nil
+	case "desktop":
+		return notify.NewDesktop()
+	case "command":
+		return notify.NewCommand(command)
+	case "none":
+		return notify.Silent{}, nil
 	}
+	return nil, fmt.Errorf("unknown notifier %q", spec)
+}
 
-	// Get next available filename
-	filename := getNextFilename(prefix)
-	filepath := filepath.Join(screenshotDir, filename)
+// startAutoCapture runs auto capture in the background.
+func startAutoCapture() error {
+	if watch.enabled {
+		return errors.New("auto capture is not available in watch mode")
+	}
+	if !autoRunning.CompareAndSwap(false, true) {
+		return errors.New("auto capture already running")
+	}
+	autoPaused.Store(false)
+	autoStop.Store(false)
 
-	// Save the image
-	file, err := os.Create(filepath)
-	if err != nil {
-		fmt.Printf("Error creating file: %v\n", err)
-		return
+	go func() {
+		defer autoRunning.Store(false)
+		runAutoCapture()
+	}()
+	return nil
+}
+
+// runAutoCapture captures, turns the page and repeats until the end of the
+// book is detected, the page limit is reached or it is stopped.
+func runAutoCapture() {
+	fmt.Println("Auto capture started")
+	saved, duplicates := 0, 0
+
+	for {
+		for autoPaused.Load() && !autoStop.Load() {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if autoStop.Load() {
+			fmt.Printf("Auto capture stopped (%d pages saved)\n", saved)
+			return
+		}
+
+		switch captures.Capture(false) {
+		case pipeline.Saved:
+			saved++
+			duplicates = 0
+		case pipeline.Duplicate:
+			duplicates++
+		case pipeline.Failed:
+			fmt.Println("Auto capture stopped: capture failed")
+			return
+		case pipeline.Ended:
+			if captures.Stopping() {
+				fmt.Printf("Auto capture stopped: quitting (%d pages saved)\n", saved)
+				return
+			}
+			fmt.Printf("Auto capture finished: no more frames (%d pages saved)\n", saved)
+			return
+		case pipeline.Rejected:
+			// A dialog or stuck loading screen needs the user; capture the
+			// same page again once they resume
+			autoPaused.Store(true)
+			fmt.Printf("Auto capture paused: frame rejected. Clear the screen and press %s to resume\n", keymap.Format(keys[keymap.Pause]))
+			continue
+		}
+
+		// The page stops changing once the last page has been reached
+		if duplicates >= auto.endAfter {
+			fmt.Printf("Auto capture finished: %d identical pages in a row, end of book (%d pages saved)\n", duplicates, saved)
+			return
+		}
+		if auto.maxPages > 0 && saved >= auto.maxPages {
+			fmt.Printf("Auto capture finished: page limit of %d reached\n", auto.maxPages)
+			return
+		}
+
+		if !auto.verify {
+			if err := pageTurner.Turn(); err != nil {
+				fmt.Printf("Auto capture stopped: %v (%d pages saved)\n", err, saved)
+				return
+			}
+			time.Sleep(auto.delay)
+			continue
+		}
+		if err := turnPage(); errors.Is(err, errEndOfBook) {
+			fmt.Printf("Auto capture finished: page did not turn after %d tries, end of book (%d pages saved)\n", auto.turnRetries+1, saved)
+			return
+		} else if err != nil {
+			fmt.Printf("Auto capture stopped: %v (%d pages saved)\n", err, saved)
+			return
+		}
 	}
-	defer file.Close()
+}
 
-	if err := png.Encode(file, img); err != nil {
-		fmt.Printf("Error encoding PNG: %v\n", err)
-		return
+// errEndOfBook reports that the page stays on the last saved page however
+// often it is turned.
+var errEndOfBook = errors.New("end of book")
+
+// turnPage turns the page and waits until the page has changed
+// and any page-turn animation has finished. The key is pressed again if the
+// page doesn't change in time.
+func turnPage() error {
+	before, saved := captures.Frames()
+
+	for attempt := 0; attempt <= auto.turnRetries; attempt++ {
+		if attempt > 0 {
+			fmt.Printf("Page did not change, trying %s again (retry %d/%d)\n", pageTurner.Name(), attempt, auto.turnRetries)
+		}
+
+		if err := pageTurner.Turn(); err != nil {
+			return err
+		}
+		time.Sleep(auto.delay)
+
+		changed, err := waitForStableFrame(before)
+		if err != nil {
+			return err
+		}
+		if changed {
+			return nil
+		}
 	}
 
-	fmt.Printf("Screenshot saved to: %s\n", filepath)
+	// Still showing the last saved page, by either dedup test: the book
+	// has ended. Anything else, such as a dialog, needs the user.
+	if before != nil && saved != nil {
+		similar, _ := isSimilar(saved, before)
+		if similar || hashFunc(saved).Distance(hashFunc(before)) <= hashDistance {
+			return errEndOfBook
+		}
+	}
+	return fmt.Errorf("page did not change after %d tries of %s (end of book, or reader not focused?)", auto.turnRetries+1, pageTurner.Name())
 }
 
-func getNextFilename(prefix string) string {
-	// Find the highest number in existing files
-	files, err := os.ReadDir(screenshotDir)
-	maxNum := 0
+// waitForStableFrame samples the capture region until it differs from
+// before and then stays the same for auto.stableFrames samples. It reports
+// whether the page changed at all within auto.turnTimeout.
+func waitForStableFrame(before *image.RGBA) (bool, error) {
+	deadline := time.Now().Add(auto.turnTimeout)
+	detector := settle.New(before, settle.Settings{Threshold: similarityThreshold, Frames: auto.stableFrames})
 
-	if err == nil {
-		for _, file := range files {
-			if strings.HasPrefix(file.Name(), prefix) && strings.HasSuffix(file.Name(), ".png") {
-				// Extract number from filename like "screen_001.png" or "kindle_001.png"
-				name := strings.TrimSuffix(file.Name(), ".png")
-				parts := strings.Split(name, "_")
-				if len(parts) == 2 {
-					if num, err := strconv.Atoi(parts[1]); err == nil && num > maxNum {
-						maxNum = num
-					}
-				}
+	for {
+		frame, err := capturer.Capture()
+		if err != nil {
+			return false, err
+		}
+
+		changed, settled := detector.Add(frame.Image, time.Now())
+		if settled {
+			return true, nil
+		}
+
+		if time.Now().After(deadline) {
+			if changed {
+				// Still moving, but it did turn; let dedup judge the capture
+				fmt.Println("Page still changing at timeout, capturing anyway")
 			}
+			return changed, nil
 		}
+		time.Sleep(auto.pollInterval)
 	}
+}
+
+// runReplay feeds every frame of a replay source through the capture
+// pipeline, so old sessions can be rerun with new dedup settings.
+func runReplay() {
+	fmt.Printf("Replaying captures into %s\n", screenshotDir)
+	saved, skipped := 0, 0
+
+	for {
+		switch captures.Capture(false) {
+		case pipeline.Saved:
+			saved++
+		case pipeline.Duplicate, pipeline.Rejected:
+			skipped++
+		case pipeline.Ended:
+			if captures.Stopping() {
+				fmt.Printf("Replay stopped: %d pages saved, %d duplicates skipped\n", saved, skipped)
+				return
+			}
+			fmt.Printf("Replay finished: %d pages saved, %d duplicates skipped\n", saved, skipped)
+			return
+		}
+	}
+}
+
+// runWatch samples the capture region while the user pages by hand and
+// captures every page that changes and then holds still. Captures are at
+// least watch.minGap apart, so scrolling or animations that pause briefly
+// don't produce bursts; dedup drops whatever repeats.
+func runWatch() {
+	fmt.Printf("Watching for page changes every %v\n", watch.interval)
+
+	baseline, _ := captures.Frames()
+	detector := settle.New(baseline, settle.Settings{
+		Threshold: similarityThreshold,
+		Frames:    watch.stableFrames,
+		MinGap:    watch.minGap,
+	})
+
+	for ; !captures.Stopping(); time.Sleep(watch.interval) {
+		if watchPaused.Load() {
+			detector.Reset()
+			continue
+		}
+
+		frame, err := capturer.Capture()
+		if err != nil {
+			fmt.Printf("Watch: failed to sample page: %v\n", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		// A settled page is held until the gap has passed
+		if _, settled := detector.Add(frame.Image, time.Now()); !settled {
+			continue
+		}
+
+		if captures.Capture(false) == pipeline.Ended {
+			return
+		}
+
+		// Compare against what was on screen, even if it wasn't saved, so a
+		// rejected or failed page isn't retried until it changes
+		detector.Rebase(frame.Image, time.Now())
+	}
+}
+
+// toggleWatchPause pauses or resumes watch mode.
+func toggleWatchPause() {
+	if watchPaused.Load() {
+		watchPaused.Store(false)
+		fmt.Println("Watching for page changes again")
+	} else {
+		watchPaused.Store(true)
+		fmt.Println("Watch paused")
+	}
+}
+
+// toggleAutoPause pauses a running auto capture, or resumes a paused one.
+func toggleAutoPause() {
+	if err := setAutoPaused(!autoPaused.Load()); err != nil {
+		fmt.Printf("%v\n", err)
+	}
+}
+
+func setAutoPaused(paused bool) error {
+	if !autoRunning.Load() {
+		return errors.New("auto capture is not running")
+	}
+
+	autoPaused.Store(paused)
+	if paused {
+		fmt.Println("Auto capture paused")
+	} else {
+		fmt.Println("Auto capture resumed")
+	}
+	return nil
+}
+
+// controller exposes the capture tool to the HTTP control API.
+type controller struct{}
+
+func (controller) Capture(force bool) string { return captures.Capture(force).String() }
+func (controller) StartAuto() error          { return startAutoCapture() }
+func (controller) PauseAuto() error          { return setAutoPaused(true) }
+func (controller) ResumeAuto() error         { return setAutoPaused(false) }
+
+func (controller) StopAuto() error {
+	if !autoRunning.Load() {
+		return errors.New("auto capture is not running")
+	}
+	autoStop.Store(true)
+	fmt.Println("Stopping auto capture")
+	return nil
+}
+
+func (controller) Stats() control.Stats {
+	s := captures.Stats()
+	s.Session, s.Auto = sessionID, "idle"
+	if autoRunning.Load() {
+		s.Auto = "running"
+		if autoPaused.Load() {
+			s.Auto = "paused"
+		}
+	}
+	return s
+}
+
+func (controller) Latest() image.Image {
+	// A nil *image.RGBA would make a non-nil image.Image
+	if img := captures.Latest(); img != nil {
+		return img
+	}
+	return nil
+}
+
+// undoLastCapture deletes the most recent capture of the session, unless
+// auto capture is still taking new ones.
+func undoLastCapture() {
+	if autoRunning.Load() && !autoPaused.Load() {
+		fmt.Println("Pause auto capture before undoing")
+		return
+	}
+
+	captures.Undo()
+}
 
-	// Return next filename
-	return fmt.Sprintf("%s_%03d.png", prefix, maxNum+1)
+// isSimilar reports whether two captures show the same page, along with
+// the ratio of sampled pixels that differ.
+func isSimilar(img1, img2 *image.RGBA) (bool, float64) {
+	diffRatio := similarity.Diff(img1, img2)
+	return diffRatio < similarityThreshold, diffRatio
 }
@@ -0,0 +1,172 @@
+// Package manifest writes the per-capture provenance log of a capture
+// session as JSON Lines, one record per capture attempt.
+package manifest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Decisions recorded for a capture.
+const (
+	Saved         = "saved"
+	Duplicate     = "duplicate"      // Similar to the previous page
+	NearDuplicate = "near-duplicate" // Hash matched an earlier page
+	Failed        = "failed"
+	Undone        = "undone"   // A previously saved File was deleted
+	Rejected      = "rejected" // Blank, loading or overlay frame, see Reason
+)
+
+// Rect is a rectangle in screen coordinates.
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// RectOf converts an image.Rectangle.
+func RectOf(r image.Rectangle) Rect {
+	return Rect{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+// Record describes one capture attempt.
+type Record struct {
+	Time       time.Time `json:"time"`
+	Session    string    `json:"session"`
+	Profile    string    `json:"profile,omitempty"` // Reader-app profile of the session
+	Backend    string    `json:"backend"`
+	Source     string    `json:"source,omitempty"`     // Replayed image the frame came from
+	Window     bool      `json:"window"`               // False for a full-display fallback
+	Calibrated bool      `json:"calibrated,omitempty"` // Calibrated insets already trimmed the window chrome
+	Bounds     Rect      `json:"bounds"`
+	Display    int       `json:"display"`
+	Scale      float64   `json:"scale,omitempty"` // Image pixels per unit of Bounds (2 on Retina)
+	Hash       string    `json:"hash,omitempty"`
+	Diff       *float64  `json:"diff,omitempty"` // Different-pixel ratio against the previous page
+	Decision   string    `json:"decision"`
+	Forced     bool      `json:"forced,omitempty"` // Saved via the force hotkey despite dedup
+	File       string    `json:"file,omitempty"`   // Saved file name
+	Page       int       `json:"page,omitempty"`   // Sequence number of File
+	Format     string    `json:"format,omitempty"` // Storage format of File
+	Match      string    `json:"match,omitempty"`  // Earlier file a near-duplicate matched
+	Reason     string    `json:"reason,omitempty"` // Why the frame was rejected
+	Error      string    `json:"error,omitempty"`
+}
+
+// Writer appends records to a manifest file.
+type Writer struct {
+	mu      sync.Mutex
+	file    *os.File
+	session string
+	profile string
+}
+
+// Open opens (or creates) the manifest at path for appending. Every record
+// written through it is tagged with session and profile.
+func Open(path, session, profile string) (*Writer, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+
+	// Terminate a line cut short by a kill, so new records start afresh
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			file.Write([]byte{'\n'})
+		}
+	}
+	return &Writer{file: file, session: session, profile: profile}, nil
+}
+
+// Write appends r as a single line.
+func (w *Writer) Write(r Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	r.Session, r.Profile = w.session, w.profile
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := w.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append to manifest: %w", err)
+	}
+	return nil
+}
+
+// Close closes the manifest file.
+func (w *Writer) Close() error {
+	return w.file.Close()
+}
+
+// Read loads every record of the manifest at path, oldest first. A missing
+// manifest has no records. Lines truncated by a kill mid-write are skipped.
+func Read(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			var syntax *json.SyntaxError
+			if errors.As(err, &syntax) && syntax.Offset == int64(len(scanner.Bytes())) {
+				continue
+			}
+			return nil, fmt.Errorf("manifest %s line %d: %w", path, line, err)
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return records, nil
+}
+
+// SavedFiles returns the files session saved that were not undone later,
+// oldest first.
+func SavedFiles(records []Record, session string) []string {
+	var ordered []Record
+	for _, r := range records {
+		if r.Session == session && r.File != "" {
+			ordered = append(ordered, r)
+		}
+	}
+	// Saves are logged as they finish, which need not be capture order
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Time.Before(ordered[j].Time) })
+
+	var files []string
+	for _, r := range ordered {
+		switch r.Decision {
+		case Saved:
+			files = append(files, r.File)
+		case Undone:
+			for i := len(files) - 1; i >= 0; i-- {
+				if files[i] == r.File {
+					files = append(files[:i], files[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return files
+}
@@ -0,0 +1,104 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.jsonl")
+
+	w, err := Open(path, "s1", "kindle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(Record{Decision: Saved, File: "kindle_001.png"}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// Killed halfway through the second record
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"time":"2026-01-01T00:00:00Z","session":"s1","deci`)
+	file.Close()
+
+	records, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read with a torn last line: %v", err)
+	}
+	if len(records) != 1 || records[0].File != "kindle_001.png" || records[0].Profile != "kindle" {
+		t.Errorf("Read = %+v, want the one complete record", records)
+	}
+
+	// Writing on after the restart keeps the new records readable
+	w, err = Open(path, "s1", "kindle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(Record{Decision: Saved, File: "kindle_002.png"}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	records, err = Read(path)
+	if err != nil {
+		t.Fatalf("Read after resuming: %v", err)
+	}
+	if len(records) != 2 || records[1].File != "kindle_002.png" {
+		t.Errorf("Read = %+v, want kindle_001.png and kindle_002.png", records)
+	}
+
+	// Anything but a truncated line is still an error
+	if err := os.WriteFile(path, []byte("{\"session\":\"s1\"}\nnot json\n{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path); err == nil {
+		t.Error("Read of a corrupt manifest succeeded")
+	}
+}
+
+func TestReadMissing(t *testing.T) {
+	records, err := Read(filepath.Join(t.TempDir(), "manifest.jsonl"))
+	if err != nil || records != nil {
+		t.Errorf("Read of a missing manifest = %v, %v, want no records", records, err)
+	}
+}
+
+func TestSavedFiles(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	// Saves finish out of order; records are logged as they finish
+	records := []Record{
+		{Time: at(0), Session: "s0", Decision: Saved, File: "kindle_001.png"},
+		{Time: at(2), Session: "s1", Decision: Saved, File: "kindle_003.png"},
+		{Time: at(1), Session: "s1", Decision: Saved, File: "kindle_002.png"},
+		{Time: at(3), Session: "s1", Decision: Duplicate},
+		{Time: at(4), Session: "s1", Decision: Saved, File: "kindle_004.png"},
+		{Time: at(5), Session: "s1", Decision: Undone, File: "kindle_004.png"},
+		{Time: at(6), Session: "s1", Decision: Failed, File: "kindle_004.png"},
+		{Time: at(7), Session: "s1", Decision: Saved, File: "kindle_004.png"},
+		{Time: at(8), Session: "s1", Decision: Saved, File: "kindle_005.png"},
+		{Time: at(9), Session: "s1", Decision: Undone, File: "kindle_002.png"},
+	}
+
+	tests := []struct {
+		session string
+		want    []string
+	}{
+		{"s0", []string{"kindle_001.png"}},
+		{"s1", []string{"kindle_003.png", "kindle_004.png", "kindle_005.png"}},
+		{"s2", nil},
+	}
+	for _, tt := range tests {
+		if got := SavedFiles(records, tt.session); !slices.Equal(got, tt.want) {
+			t.Errorf("SavedFiles(%s) = %v, want %v", tt.session, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Desktop shows freedesktop.org notifications over the D-Bus session bus.
+// Each notification replaces the previous one so they don't pile up during
+// a long scan.
+type Desktop struct {
+	mu      sync.Mutex
+	conn    *dbus.Conn
+	replace uint32
+}
+
+// desktopTimeout bounds each notification, so a stalled notification
+// daemon can't hold up captures
+const desktopTimeout = 2 * time.Second
+
+// NewDesktop connects to the session bus.
+func NewDesktop() (*Desktop, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+	return &Desktop{conn: conn}, nil
+}
+
+func (d *Desktop) Notify(e Event, message string) error {
+	icons := map[Event]string{Saved: "document-save", Skipped: "edit-copy", Failed: "dialog-error"}
+	urgency := byte(1)
+	if e == Failed {
+		urgency = 2
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), desktopTimeout)
+	defer cancel()
+
+	obj := d.conn.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications")
+	call := obj.CallWithContext(ctx, "org.freedesktop.Notifications.Notify", 0,
+		"Screenshot capture",  // app_name
+		d.replace,             // replaces_id
+		icons[e],              // app_icon
+		"Capture "+e.String(), // summary
+		message,               // body
+		[]string{},            // actions
+		map[string]dbus.Variant{"urgency": dbus.MakeVariant(urgency)},
+		int32(3000), // expire_timeout in ms
+	)
+	if call.Err != nil {
+		return fmt.Errorf("desktop notification failed: %w", call.Err)
+	}
+	return call.Store(&d.replace)
+}
@@ -0,0 +1,127 @@
+// Package notify gives audible or visual feedback after each capture, with a
+// distinct cue for saved, skipped and failed pages.
+package notify
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Event is the outcome being announced.
+type Event int
+
+const (
+	Saved   Event = iota
+	Skipped       // Skipped as a duplicate
+	Failed
+)
+
+func (e Event) String() string {
+	switch e {
+	case Saved:
+		return "saved"
+	case Skipped:
+		return "skipped"
+	case Failed:
+		return "failed"
+	}
+	return fmt.Sprintf("event(%d)", int(e))
+}
+
+// Notifier announces capture outcomes. Notify must not block the capture
+// for long; slow backends do their work in the background.
+type Notifier interface {
+	Notify(e Event, message string) error
+}
+
+// Silent discards every event.
+type Silent struct{}
+
+func (Silent) Notify(Event, string) error { return nil }
+
+// Bell rings the terminal bell: once for saved, twice for skipped and three
+// times for failed captures.
+type Bell struct {
+	W io.Writer
+}
+
+func (b Bell) Notify(e Event, _ string) error {
+	_, err := io.WriteString(b.W, strings.Repeat("\a", int(e)+1))
+	return err
+}
+
+// Command runs an external program per event. Events without an entry are
+// silent. The placeholders {event} and {message} are substituted in every
+// argument.
+type Command struct {
+	Argv map[Event][]string
+}
+
+// NewCommand uses one whitespace-separated command line for every event,
+// e.g. "paplay /usr/share/sounds/capture-{event}.oga".
+func NewCommand(line string) (*Command, error) {
+	argv := strings.Fields(line)
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("empty notify command")
+	}
+	return &Command{Argv: map[Event][]string{Saved: argv, Skipped: argv, Failed: argv}}, nil
+}
+
+// SystemSounds plays macOS system sounds through afplay.
+func SystemSounds() *Command {
+	sound := func(name string) []string {
+		return []string{"afplay", "/System/Library/Sounds/" + name + ".aiff"}
+	}
+	return &Command{Argv: map[Event][]string{
+		Saved:   sound("Glass"),
+		Skipped: sound("Pop"),
+		Failed:  sound("Basso"),
+	}}
+}
+
+func (c *Command) Notify(e Event, message string) error {
+	template, ok := c.Argv[e]
+	if !ok {
+		return nil
+	}
+
+	r := strings.NewReplacer("{event}", e.String(), "{message}", message)
+	argv := make([]string, len(template))
+	for i, arg := range template {
+		argv[i] = r.Replace(arg)
+	}
+
+	cmd := exec.Command(argv[0], argv[1:]...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run %s: %w", argv[0], err)
+	}
+
+	// Reap the process in the background so sounds don't hold up captures
+	go cmd.Wait()
+	return nil
+}
+
+// Recorder keeps every event in memory, for tests and headless runs.
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *Recorder) Notify(e Event, _ string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, e)
+	return nil
+}
+
+// Events returns the events recorded so far.
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Event(nil), r.events...)
+}
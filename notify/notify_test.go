@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBell(t *testing.T) {
+	tests := []struct {
+		e    Event
+		want string
+	}{
+		{Saved, "\a"},
+		{Skipped, "\a\a"},
+		{Failed, "\a\a\a"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := (Bell{W: &buf}).Notify(tt.e, "ignored"); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("Bell.Notify(%v) wrote %q, want %q", tt.e, buf.String(), tt.want)
+		}
+	}
+}
+
+// waitForFile returns the contents of path once it has some, or "" after a
+// few seconds.
+func waitForFile(path string) string {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+			return string(data)
+		}
+	}
+	return ""
+}
+
+func TestCommand(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	c := &Command{Argv: map[Event][]string{
+		Saved:   {"sh", "-c", "echo {event}: {message} > " + out},
+		Skipped: {"sh", "-c", "echo {event} > " + out},
+	}}
+
+	if err := c.Notify(Saved, "page 3"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(waitForFile(out)); got != "saved: page 3" {
+		t.Errorf("Notify(Saved) ran with %q, want %q", got, "saved: page 3")
+	}
+	os.Remove(out)
+
+	// Events without a command are silent
+	if err := c.Notify(Failed, "oops"); err != nil {
+		t.Errorf("Notify(Failed) without a command = %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(out); err == nil {
+		t.Errorf("Notify(Failed) ran a command")
+	}
+
+	missing := &Command{Argv: map[Event][]string{Saved: {filepath.Join(dir, "no-such-program")}}}
+	if err := missing.Notify(Saved, ""); err == nil {
+		t.Errorf("Notify with a missing program succeeded")
+	}
+}
+
+func TestNewCommand(t *testing.T) {
+	if _, err := NewCommand("  "); err == nil {
+		t.Errorf("NewCommand of an empty line succeeded")
+	}
+	c, err := NewCommand("play capture-{event}.oga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []Event{Saved, Skipped, Failed} {
+		if want := []string{"play", "capture-{event}.oga"}; !slices.Equal(c.Argv[e], want) {
+			t.Errorf("NewCommand argv for %v = %q, want %q", e, c.Argv[e], want)
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	var r Recorder
+	for _, e := range []Event{Saved, Failed, Skipped, Saved} {
+		r.Notify(e, "")
+	}
+	events := r.Events()
+	if want := []Event{Saved, Failed, Skipped, Saved}; !slices.Equal(events, want) {
+		t.Errorf("Events() = %v, want %v", events, want)
+	}
+
+	// The returned slice is a copy
+	events[0] = Failed
+	if r.Events()[0] != Saved {
+		t.Errorf("Events() shares its slice with the recorder")
+	}
+}
@@ -0,0 +1,100 @@
+package pages
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Sequence hands out capture file names such as "kindle_0042.png". The
+// counters live in memory and are seeded by a single directory scan, so
+// concurrent captures can never be given the same name. Claims are not
+// written to disk: the capture writer creates the file once the image is
+// complete, and must not replace a file that appeared in the meantime.
+type Sequence struct {
+	mu   sync.Mutex
+	dir  string
+	pad  int
+	last map[string]int // Highest number allocated per prefix
+}
+
+// NewSequence scans dir once to find the highest number already used for
+// each prefix. Numbers are zero-padded to pad digits.
+func NewSequence(dir string, pad int) (*Sequence, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to scan %s: %w", dir, err)
+	}
+
+	s := &Sequence{dir: dir, pad: pad, last: map[string]int{}}
+	for _, file := range files {
+		if prefix, n, ok := Number(file.Name()); ok && n > s.last[prefix] {
+			s.last[prefix] = n
+		}
+	}
+	return s, nil
+}
+
+// Number splits a capture file name like "kindle_012.png" into its prefix
+// and page number.
+func Number(name string) (string, int, bool) {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	i := strings.LastIndex(name, "_")
+	if i <= 0 {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	if err != nil || n < 0 {
+		return "", 0, false
+	}
+	return name[:i], n, true
+}
+
+// Name formats the file name for page n.
+func (s *Sequence) Name(prefix string, n int, ext string) string {
+	return fmt.Sprintf("%s_%0*d%s", prefix, s.pad, n, ext)
+}
+
+// Next claims the next free file name for prefix, and returns the name and
+// its number. Names taken by files that appeared since the scan are skipped.
+func (s *Sequence) Next(prefix, ext string) (string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for n := s.last[prefix] + 1; ; n++ {
+		name := s.Name(prefix, n, ext)
+		_, err := os.Lstat(filepath.Join(s.dir, name))
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", 0, err
+		}
+
+		s.last[prefix] = n
+		return name, n, nil
+	}
+}
+
+// Release returns page n to the pool if it was the last one handed out for
+// prefix, so that an undone capture's number is reused.
+func (s *Sequence) Release(prefix string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.last[prefix] == n {
+		s.last[prefix] = n - 1
+	}
+}
+
+// Last returns the highest number handed out for prefix.
+func (s *Sequence) Last(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.last[prefix]
+}
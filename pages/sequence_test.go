@@ -0,0 +1,63 @@
+package pages
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSequence(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"kindle_7.png", "kindle_0012.png", "books_003.png", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := NewSequence(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Last("kindle") != 12 || s.Last("books") != 3 || s.Last("screen") != 0 {
+		t.Errorf("scan found kindle %d, books %d, screen %d, want 12, 3 and 0", s.Last("kindle"), s.Last("books"), s.Last("screen"))
+	}
+
+	next := func(prefix, wantName string, wantN int) {
+		t.Helper()
+		name, n, err := s.Next(prefix, ".png")
+		if err != nil || name != wantName || n != wantN {
+			t.Errorf("Next(%s) = %q, %d, %v, want %q, %d", prefix, name, n, err, wantName, wantN)
+		}
+	}
+
+	next("kindle", "kindle_013.png", 13)
+	next("kindle", "kindle_014.png", 14)
+	next("screen", "screen_001.png", 1)
+
+	// Claims stay in memory until the capture is written
+	if _, err := os.Stat(filepath.Join(dir, "kindle_013.png")); !os.IsNotExist(err) {
+		t.Errorf("Next created kindle_013.png on disk (%v)", err)
+	}
+
+	// Only the last number handed out can be released
+	s.Release("kindle", 13)
+	next("kindle", "kindle_015.png", 15)
+	s.Release("kindle", 15)
+	next("kindle", "kindle_015.png", 15)
+
+	// Files created behind the sequence's back are skipped
+	if err := os.WriteFile(filepath.Join(dir, "kindle_016.png"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	next("kindle", "kindle_017.png", 17)
+}
+
+func TestNewSequenceMissingDir(t *testing.T) {
+	s, err := NewSequence(filepath.Join(t.TempDir(), "new"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, n, err := s.Next("kindle", ".png"); err != nil || name != "kindle_001.png" || n != 1 {
+		t.Errorf("Next = %q, %d, %v, want kindle_001.png", name, n, err)
+	}
+}
@@ -0,0 +1,64 @@
+// Package pages orders and numbers page captures. Every stage that walks a
+// capture directory sorts with Sort, so "kindle_1000.png" follows
+// "kindle_999.png" however the numbers were padded.
+package pages
+
+import (
+	"sort"
+	"strings"
+)
+
+// Sort orders names naturally: runs of digits compare by numeric value.
+func Sort(names []string) {
+	sort.SliceStable(names, func(i, j int) bool { return Less(names[i], names[j]) })
+}
+
+// Less reports whether a sorts before b in natural order.
+func Less(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := isDigit(a[0]), isDigit(b[0])
+		switch {
+		case da && db:
+			na, restA := digitRun(a)
+			nb, restB := digitRun(b)
+			if c := compareNumbers(na, nb); c != 0 {
+				return c < 0
+			}
+			// Equal values: fewer leading zeros first, for a stable order
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			a, b = restA, restB
+		case a[0] != b[0]:
+			return a[0] < b[0]
+		default:
+			a, b = a[1:], b[1:]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func digitRun(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// compareNumbers compares two digit strings of any length numerically.
+func compareNumbers(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,64 @@
+package pages
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"kindle_999.png", "kindle_1000.png", true},
+		{"kindle_1000.png", "kindle_999.png", false},
+		{"kindle_001.png", "kindle_002.png", true},
+		{"kindle_002.png", "kindle_10.png", true},
+		{"kindle_0999.png", "kindle_1000.png", true},
+		{"kindle_01.png", "kindle_001.png", true}, // Same number, fewer zeros first
+		{"kindle_001.png", "kindle_01.png", false},
+		{"books_5.png", "kindle_1.png", true},
+		{"kindle_1.png", "kindle_1.png", false},
+		{"kindle_1.png", "kindle_1_left.png", true},
+		{"kindle_99999999999999999999.png", "kindle_100000000000000000000.png", true},
+		{"", "a", true},
+		{"a", "", false},
+	}
+	for _, tt := range tests {
+		if got := Less(tt.a, tt.b); got != tt.want {
+			t.Errorf("Less(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	names := []string{"kindle_1000.png", "kindle_10.png", "kindle_999.png", "kindle_2.png", "kindle_001.png"}
+	Sort(names)
+	want := []string{"kindle_001.png", "kindle_2.png", "kindle_10.png", "kindle_999.png", "kindle_1000.png"}
+	if !slices.Equal(names, want) {
+		t.Errorf("Sort = %v, want %v", names, want)
+	}
+}
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		n      int
+		ok     bool
+	}{
+		{"kindle_012.png", "kindle", 12, true},
+		{"screen_1000.webp", "screen", 1000, true},
+		{"my_book_7.jpg", "my_book", 7, true},
+		{"kindle_012_left.png", "", 0, false},
+		{"kindle.png", "", 0, false},
+		{"_12.png", "", 0, false},
+		{"kindle_-1.png", "", 0, false},
+	}
+	for _, tt := range tests {
+		prefix, n, ok := Number(tt.name)
+		if prefix != tt.prefix || n != tt.n || ok != tt.ok {
+			t.Errorf("Number(%q) = %q, %d, %v, want %q, %d, %v", tt.name, prefix, n, ok, tt.prefix, tt.n, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package phash
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// Entry records the hash of one saved capture.
+type Entry struct {
+	File    string `json:"file"`
+	Algo    string `json:"algo"`
+	Hash    Hash   `json:"hash"`
+	Session string `json:"session,omitempty"`
+}
+
+// Index is a JSON Lines file of capture hashes, shared by every session
+// that captures into the directory. New entries are appended; removals
+// rewrite the file. Only entries of the index's own session and algorithm
+// are used for matching, so one book is never deduplicated against another.
+type Index struct {
+	mu      sync.Mutex
+	path    string
+	algo    string
+	session string
+	entries []Entry
+}
+
+// OpenIndex loads the index at path, starting empty if it does not exist.
+// Entries whose file has been deleted by hand are dropped.
+func OpenIndex(path, algo, session string) (*Index, error) {
+	ix := &Index{path: path, algo: algo, session: session}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open hash index: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("hash index %s line %d: %w", path, line, err)
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(path), e.File)); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		ix.entries = append(ix.entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read hash index: %w", err)
+	}
+
+	return ix, nil
+}
+
+// Nearest returns the indexed capture closest to h and its distance.
+func (ix *Index) Nearest(h Hash) (Entry, int, bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	var best Entry
+	bestDist, found := Size+1, false
+	for _, e := range ix.entries {
+		if e.Algo != ix.algo || e.Session != ix.session {
+			continue
+		}
+		if d := e.Hash.Distance(h); d < bestDist {
+			best, bestDist, found = e, d, true
+		}
+	}
+	return best, bestDist, found
+}
+
+// Within returns the indexed captures at most maxDist from h, nearest
+// first.
+func (ix *Index) Within(h Hash, maxDist int) []Entry {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	var matches []Entry
+	var dists []int
+	for _, e := range ix.entries {
+		if e.Algo != ix.algo || e.Session != ix.session {
+			continue
+		}
+		if d := e.Hash.Distance(h); d <= maxDist {
+			i, _ := slices.BinarySearch(dists, d+1)
+			matches = slices.Insert(matches, i, e)
+			dists = slices.Insert(dists, i, d)
+		}
+	}
+	return matches
+}
+
+// Add records the hash of a saved file and appends it to the index file.
+func (ix *Index) Add(file string, h Hash) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	e := Entry{File: file, Algo: ix.algo, Hash: h, Session: ix.session}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(ix.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open hash index: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append to hash index: %w", err)
+	}
+
+	ix.entries = append(ix.entries, e)
+	return nil
+}
+
+// Remove drops every entry for file, e.g. after the capture was undone.
+func (ix *Index) Remove(file string) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	kept := ix.entries[:0:0]
+	var buf []byte
+	for _, e := range ix.entries {
+		if e.File == file {
+			continue
+		}
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+		kept = append(kept, e)
+	}
+
+	// Write to a temporary file first so a crash can't truncate the index
+	tmp := ix.path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0644); err != nil {
+		return fmt.Errorf("failed to rewrite hash index: %w", err)
+	}
+	if err := os.Rename(tmp, ix.path); err != nil {
+		return fmt.Errorf("failed to rewrite hash index: %w", err)
+	}
+
+	ix.entries = kept
+	return nil
+}
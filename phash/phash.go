@@ -0,0 +1,186 @@
+// Package phash computes perceptual hashes of page captures so that repeated
+// pages can be recognised even when they are not adjacent.
+package phash
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// Size is the hash length in bits. Text pages look alike at low resolution,
+// so the hashes use a 16x16 grid rather than the classic 8x8.
+const Size = 256
+
+// Hash is a 256-bit perceptual hash.
+type Hash [Size / 64]uint64
+
+// Distance returns the Hamming distance between two hashes.
+func (h Hash) Distance(other Hash) int {
+	d := 0
+	for i := range h {
+		d += bits.OnesCount64(h[i] ^ other[i])
+	}
+	return d
+}
+
+func (h Hash) String() string {
+	buf := make([]byte, 0, Size/8)
+	for _, word := range h {
+		for shift := 56; shift >= 0; shift -= 8 {
+			buf = append(buf, byte(word>>shift))
+		}
+	}
+	return hex.EncodeToString(buf)
+}
+
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+func (h *Hash) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*h = parsed
+	return nil
+}
+
+// Parse decodes the hex form produced by Hash.String.
+func Parse(s string) (Hash, error) {
+	var h Hash
+	buf, err := hex.DecodeString(s)
+	if err != nil || len(buf) != Size/8 {
+		return h, fmt.Errorf("invalid hash %q", s)
+	}
+	for i, b := range buf {
+		h[i/8] |= uint64(b) << (56 - 8*(i%8))
+	}
+	return h, nil
+}
+
+func (h *Hash) set(bit int) {
+	h[bit/64] |= 1 << (63 - bit%64)
+}
+
+// Func returns the hash function registered under name ("dhash" or "phash").
+func Func(name string) (func(image.Image) Hash, error) {
+	switch name {
+	case "dhash":
+		return DHash, nil
+	case "phash":
+		return PHash, nil
+	}
+	return nil, fmt.Errorf("unknown hash algorithm %q (want dhash or phash)", name)
+}
+
+// DHash is a difference hash: each bit records whether a cell of a 17x16
+// grayscale thumbnail is brighter than its right-hand neighbour.
+func DHash(img image.Image) Hash {
+	const w, h = 17, 16
+	grid := grayGrid(img, w, h)
+
+	var hash Hash
+	bit := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			if grid[y*w+x] > grid[y*w+x+1] {
+				hash.set(bit)
+			}
+			bit++
+		}
+	}
+	return hash
+}
+
+// PHash is a DCT hash: each bit records whether one of the 16x16 lowest
+// frequency coefficients of a 64x64 thumbnail is above their median.
+func PHash(img image.Image) Hash {
+	const n, keep = 64, 16
+	grid := grayGrid(img, n, n)
+
+	// Separable 2D DCT-II, only the low frequencies are needed
+	cos := make([]float64, keep*n)
+	for u := 0; u < keep; u++ {
+		for x := 0; x < n; x++ {
+			cos[u*n+x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * n))
+		}
+	}
+
+	rows := make([]float64, n*keep)
+	for y := 0; y < n; y++ {
+		for u := 0; u < keep; u++ {
+			sum := 0.0
+			for x := 0; x < n; x++ {
+				sum += grid[y*n+x] * cos[u*n+x]
+			}
+			rows[y*keep+u] = sum
+		}
+	}
+
+	coeffs := make([]float64, keep*keep)
+	for v := 0; v < keep; v++ {
+		for u := 0; u < keep; u++ {
+			sum := 0.0
+			for y := 0; y < n; y++ {
+				sum += rows[y*keep+u] * cos[v*n+y]
+			}
+			coeffs[v*keep+u] = sum
+		}
+	}
+
+	// The DC term only reflects overall brightness, leave it out of the median
+	sorted := append([]float64(nil), coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash Hash
+	for i, c := range coeffs {
+		if c > median {
+			hash.set(i)
+		}
+	}
+	return hash
+}
+
+// grayGrid downsamples img to a w x h grid of average luminance values.
+func grayGrid(img image.Image, w, h int) []float64 {
+	b := img.Bounds()
+	sums := make([]float64, w*h)
+	counts := make([]float64, w*h)
+	if b.Empty() {
+		return sums
+	}
+
+	rgba, _ := img.(*image.RGBA)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		gy := (y - b.Min.Y) * h / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			gx := (x - b.Min.X) * w / b.Dx()
+
+			var r, g, bl float64
+			if rgba != nil {
+				i := rgba.PixOffset(x, y)
+				r, g, bl = float64(rgba.Pix[i]), float64(rgba.Pix[i+1]), float64(rgba.Pix[i+2])
+			} else {
+				r16, g16, b16, _ := img.At(x, y).RGBA()
+				r, g, bl = float64(r16>>8), float64(g16>>8), float64(b16>>8)
+			}
+
+			cell := gy*w + gx
+			sums[cell] += 0.299*r + 0.587*g + 0.114*bl
+			counts[cell]++
+		}
+	}
+
+	for i := range sums {
+		if counts[i] > 0 {
+			sums[i] /= counts[i]
+		}
+	}
+	return sums
+}
@@ -0,0 +1,164 @@
+package phash
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	var a, b Hash
+	b.set(0)
+	b.set(70)
+	b.set(Size - 1)
+
+	tests := []struct {
+		a, b Hash
+		want int
+	}{
+		{a, a, 0},
+		{a, b, 3},
+		{b, a, 3},
+		{b, b, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Distance(tt.b); got != tt.want {
+			t.Errorf("Distance(%v, %v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	var h Hash
+	h.set(0)
+	h.set(100)
+	h.set(Size - 1)
+
+	got, err := Parse(h.String())
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", h.String(), err)
+	}
+	if got != h {
+		t.Errorf("Parse(%q) = %v, want %v", h.String(), got, h)
+	}
+
+	for _, s := range []string{"", "xyz", strings.Repeat("0", Size/4-2), strings.Repeat("0", Size/4+2), strings.Repeat("g", Size/4)} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", s)
+		}
+	}
+}
+
+// page draws horizontal "text lines" at the given rows.
+func page(lines ...int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 200; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	for _, top := range lines {
+		for y := top; y < top+8; y++ {
+			for x := 20; x < 180; x++ {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	return img
+}
+
+func TestFuncs(t *testing.T) {
+	a := page(20, 60, 100, 140)
+	b := page(40, 120, 200, 260)
+
+	for _, name := range []string{"dhash", "phash"} {
+		f, err := Func(name)
+		if err != nil {
+			t.Fatalf("Func(%q): %v", name, err)
+		}
+		if d := f(a).Distance(f(a)); d != 0 {
+			t.Errorf("%s: same page at distance %d", name, d)
+		}
+		if d := f(a).Distance(f(b)); d < 20 {
+			t.Errorf("%s: different pages only %d bits apart", name, d)
+		}
+	}
+
+	if _, err := Func("md5"); err == nil {
+		t.Error("Func(\"md5\") succeeded, want error")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hashes.jsonl")
+	for _, name := range []string{"a.png", "b.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ha, hb, hc Hash
+	hb.set(1)
+	hc.set(1)
+	hc.set(2)
+
+	old, err := OpenIndex(path, "dhash", "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, h := range map[string]Hash{"a.png": ha, "b.png": hb, "gone.png": hc} {
+		if err := old.Add(file, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Another session must not match the first one's pages
+	other, err := OpenIndex(path, "dhash", "s2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, _, ok := other.Nearest(ha); ok {
+		t.Errorf("new session matched %s of another session", e.File)
+	}
+
+	// Reopening the session drops the file deleted by hand
+	ix, err := OpenIndex(path, "dhash", "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, d, ok := ix.Nearest(hc); !ok || e.File != "b.png" || d != 1 {
+		t.Errorf("Nearest = %s at %d (found %v), want b.png at 1", e.File, d, ok)
+	}
+
+	var files []string
+	for _, e := range ix.Within(hc, 2) {
+		files = append(files, e.File)
+	}
+	if want := []string{"b.png", "a.png"}; !slices.Equal(files, want) {
+		t.Errorf("Within(2) = %v, want %v", files, want)
+	}
+	if n := len(ix.Within(hc, 0)); n != 0 {
+		t.Errorf("Within(0) = %d entries, want none", n)
+	}
+
+	if err := ix.Remove("b.png"); err != nil {
+		t.Fatal(err)
+	}
+	if e, d, ok := ix.Nearest(hb); !ok || e.File != "a.png" || d != 1 {
+		t.Errorf("after Remove, Nearest = %s at %d (found %v), want a.png at 1", e.File, d, ok)
+	}
+
+	// Other algorithms are ignored
+	phash, err := OpenIndex(path, "phash", "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := phash.Nearest(ha); ok {
+		t.Error("phash index matched a dhash entry")
+	}
+}
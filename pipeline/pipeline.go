@@ -0,0 +1,499 @@
+// Package pipeline runs captures through rejection, dedup, numbering and
+// saving, and records every decision in the capture manifest. It keeps the
+// state that undo and -resume step back through, and needs no cgo, so whole
+// sessions can be replayed and tested headless.
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"screenshot-capture/capture"
+	"screenshot-capture/codec"
+	"screenshot-capture/control"
+	"screenshot-capture/manifest"
+	"screenshot-capture/notify"
+	"screenshot-capture/pages"
+	"screenshot-capture/phash"
+	"screenshot-capture/reject"
+	"screenshot-capture/similarity"
+)
+
+const (
+	HashIndexFile = "hashes.jsonl"
+	ManifestFile  = "manifest.jsonl"
+)
+
+// recentPageCount is how many saved captures are kept in memory
+const recentPageCount = 8
+
+// Result is the outcome of a single capture.
+type Result int
+
+const (
+	Saved Result = iota
+	Duplicate
+	Failed
+	Ended    // the capture source has no more frames
+	Rejected // blank, loading or overlay frame
+)
+
+func (r Result) String() string {
+	switch r {
+	case Saved:
+		return "saved"
+	case Duplicate:
+		return "duplicate"
+	case Failed:
+		return "failed"
+	case Ended:
+		return "ended"
+	case Rejected:
+		return "rejected"
+	}
+	return fmt.Sprintf("Result(%d)", int(r))
+}
+
+// Config holds the settings of a capture session.
+type Config struct {
+	Dir     string // Captures, the manifest and the hash index go here
+	Session string // Session ID recorded with every capture
+	Profile string // Reader profile recorded in the manifest
+	Source  capture.Capturer
+	// Prefix names files of window captures; whole-display fallbacks are
+	// saved as "screen"
+	Prefix string
+
+	// Threshold is the different-pixel ratio below which two captures
+	// count as the same page
+	Threshold    float64
+	HashAlgo     string // dhash or phash
+	HashDistance int    // Max Hamming distance for a hash match
+
+	Encoding codec.Options
+	Padding  int // Minimum digits in file numbers
+
+	// Frames flagged by a classifier are never saved; live captures are
+	// retried a few times first since loading screens clear up by themselves
+	Classifiers   []reject.Classifier
+	RejectRetries int
+	RejectWait    time.Duration
+
+	Calibrated bool // Calibrated insets trim the window chrome off captures
+	Notifier   notify.Notifier
+
+	Workers   int // Goroutines encoding and writing captures
+	QueueSize int // Captures that may wait to be written
+}
+
+// saveJob is a capture whose file name is claimed but not yet written.
+type saveJob struct {
+	img *image.RGBA
+	rec manifest.Record
+}
+
+// Pipeline is a capture session.
+type Pipeline struct {
+	cfg      Config
+	hash     func(image.Image) phash.Hash
+	index    *phash.Index
+	sequence *pages.Sequence
+	manifest *manifest.Writer
+
+	// mu serialises captures and undos, which share the dedup state below
+	mu             sync.Mutex
+	lastScreenshot *image.RGBA
+	// lastFrame is the most recent capture, saved or not
+	lastFrame *image.RGBA
+	// savedFiles lists this session's saved captures, oldest first, so
+	// that undo can step back through them
+	savedFiles []string
+	// recentPages holds the captures of the last few saved files, so the
+	// dedup reference can be restored exactly after an undo or failed save
+	recentPages map[string]*image.RGBA
+	// samples holds the similarity samples of the session's saved pages,
+	// so hash matches can be confirmed pixel by pixel
+	samples map[string]similarity.Samples
+
+	// Saves are encoded and written by worker goroutines, so a slow encoder
+	// or disk never holds up the hotkeys
+	queue    chan saveJob
+	workers  sync.WaitGroup
+	pending  sync.WaitGroup // Queued saves not yet on disk
+	stopping atomic.Bool    // Set on quit; no new captures are started
+	closed   sync.Once
+
+	// failedSaves are saves the workers could not write. The capture state
+	// that counted them as saved is rolled back before the next capture or
+	// undo.
+	failedMu    sync.Mutex
+	failedSaves []saveJob
+
+	// Running session totals, reported by the control API
+	statsMu sync.Mutex
+	stats   control.Stats
+	latest  *image.RGBA
+}
+
+// New opens the capture directory of a session and starts the save
+// workers.
+func New(cfg Config) (*Pipeline, error) {
+	hash, err := phash.Func(cfg.HashAlgo)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Notifier == nil {
+		cfg.Notifier = notify.Silent{}
+	}
+	p := &Pipeline{
+		cfg:         cfg,
+		hash:        hash,
+		recentPages: map[string]*image.RGBA{},
+		samples:     map[string]similarity.Samples{},
+	}
+
+	// Create screenshots directory if it doesn't exist
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if p.sequence, err = pages.NewSequence(cfg.Dir, cfg.Padding); err != nil {
+		return nil, fmt.Errorf("failed to scan captures: %w", err)
+	}
+	p.removeStaleTemps()
+
+	if p.index, err = phash.OpenIndex(filepath.Join(cfg.Dir, HashIndexFile), cfg.HashAlgo, cfg.Session); err != nil {
+		return nil, fmt.Errorf("failed to load hash index: %w", err)
+	}
+
+	if p.manifest, err = manifest.Open(filepath.Join(cfg.Dir, ManifestFile), cfg.Session, cfg.Profile); err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+
+	p.queue = make(chan saveJob, max(cfg.QueueSize, 1))
+	for i := 0; i < max(cfg.Workers, 1); i++ {
+		p.workers.Add(1)
+		go p.saveWorker()
+	}
+	return p, nil
+}
+
+// Stop makes every further capture end, e.g. on quit.
+func (p *Pipeline) Stop() { p.stopping.Store(true) }
+
+// Stopping reports whether Stop or Close was called.
+func (p *Pipeline) Stopping() bool { return p.stopping.Load() }
+
+// Close stops new captures, waits for the queued ones to be written and
+// closes the manifest.
+func (p *Pipeline) Close() error {
+	var err error
+	p.closed.Do(func() {
+		p.stopping.Store(true)
+
+		// Let a capture in progress finish queueing its save
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if n := len(p.queue); n > 0 {
+			fmt.Printf("Writing %d pending captures...\n", n)
+		}
+		close(p.queue)
+		p.workers.Wait()
+		err = p.manifest.Close()
+	})
+	return err
+}
+
+// Frames returns the most recent capture, saved or not, and the last saved
+// one, which new captures are compared against.
+func (p *Pipeline) Frames() (last, saved *image.RGBA) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.lastFrame, p.lastScreenshot
+}
+
+// Stats returns the session totals.
+func (p *Pipeline) Stats() control.Stats {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	return p.stats
+}
+
+// Latest returns the most recently saved page, or nil.
+func (p *Pipeline) Latest() *image.RGBA {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	return p.latest
+}
+
+// Capture captures one page and records it in the manifest. With force
+// set, the page is saved even if it looks like a duplicate. Saved pages are
+// recorded and announced by the save worker once on disk; other outcomes
+// are announced here, once the capture state is unlocked, so a slow
+// notifier never holds up undo or the next capture.
+func (p *Pipeline) Capture(force bool) Result {
+	result, rec := p.captureLocked(force)
+
+	var err error
+	switch result {
+	case Duplicate:
+		err = p.cfg.Notifier.Notify(notify.Skipped, "Skipped duplicate page")
+	case Failed:
+		message := "Capture failed"
+		if rec.Error != "" {
+			message += ": " + rec.Error
+		}
+		err = p.cfg.Notifier.Notify(notify.Failed, message)
+	case Rejected:
+		err = p.cfg.Notifier.Notify(notify.Failed, "Rejected "+rec.Reason)
+	}
+	if err != nil {
+		fmt.Printf("Error sending notification: %v\n", err)
+	}
+	return result
+}
+
+// captureLocked runs one capture with the capture state locked and records
+// every outcome but a save in the manifest.
+func (p *Pipeline) captureLocked(force bool) (Result, manifest.Record) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopping.Load() {
+		return Ended, manifest.Record{}
+	}
+	p.rollBackFailedSaves()
+
+	rec := manifest.Record{Time: time.Now(), Backend: p.cfg.Source.Name(), Forced: force}
+	result := p.capture(&rec, force)
+	p.count(result, rec.Diff)
+	if result == Ended || result == Saved {
+		return result, rec
+	}
+
+	if err := p.manifest.Write(rec); err != nil {
+		fmt.Printf("Error writing manifest: %v\n", err)
+	}
+	return result, rec
+}
+
+// count updates the session totals. Saves are counted by the save worker
+// once they are on disk.
+func (p *Pipeline) count(result Result, diff *float64) {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	if diff != nil {
+		p.stats.LastDiff = diff
+	}
+	switch result {
+	case Saved:
+		p.latest = p.lastScreenshot
+	case Duplicate:
+		p.stats.Duplicates++
+	case Rejected:
+		p.stats.Rejected++
+	case Failed:
+		p.stats.Failed++
+	}
+}
+
+// capture runs one capture through dedup and saving, filling in rec as it
+// goes.
+func (p *Pipeline) capture(rec *manifest.Record, force bool) Result {
+	// Capture screenshot first
+	frame, reason, err := p.captureFrame()
+	if errors.Is(err, io.EOF) {
+		return Ended
+	}
+	if err != nil {
+		fmt.Printf("Failed to capture screenshot: %v\n", err)
+		rec.Decision, rec.Error = manifest.Failed, err.Error()
+		return Failed
+	}
+	if replay, ok := p.cfg.Source.(*capture.Replay); ok {
+		rec.Source = replay.Current()
+	}
+	rec.Window, rec.Bounds, rec.Display, rec.Scale = frame.Window, manifest.RectOf(frame.Bounds), frame.Display, frame.Scale
+	rec.Calibrated = p.cfg.Calibrated && frame.Window
+	if reason != "" {
+		fmt.Printf("Frame rejected: %s\n", reason)
+		rec.Decision, rec.Reason = manifest.Rejected, reason
+		return Rejected
+	}
+
+	img := frame.Image
+	p.lastFrame = img
+
+	prefix := p.cfg.Prefix
+	if frame.Window {
+		fmt.Printf("Captured %s window at (%d,%d) size %dx%d on display %d\n", p.cfg.Prefix,
+			frame.Bounds.Min.X, frame.Bounds.Min.Y, frame.Bounds.Dx(), frame.Bounds.Dy(), frame.Display)
+		if frame.Scale != 0 && frame.Scale != 1 {
+			fmt.Printf("Scale %.2f: %dx%d pixels, %.0f DPI\n", frame.Scale, img.Bounds().Dx(), img.Bounds().Dy(), frame.Scale*capture.BaseDPI)
+		}
+	} else {
+		prefix = "screen"
+		fmt.Printf("%s window not found (%v), captured display %d instead\n", p.cfg.Prefix, frame.WindowErr, frame.Display)
+	}
+
+	hash := p.hash(img)
+	rec.Hash = hash.String()
+
+	// Check if similar to last screenshot
+	if p.lastScreenshot != nil {
+		similar, diff := p.similar(p.lastScreenshot, img)
+		rec.Diff = &diff
+		fmt.Printf("Similarity check: %.2f%% different pixels\n", diff*100)
+		if similar && !force {
+			fmt.Println("Screenshot is similar to previous one, skipping...")
+			rec.Decision = manifest.Duplicate
+			return Duplicate
+		}
+	}
+
+	// Check against every page saved so far, not just the previous one
+	if !force {
+		if match, dist, ok := p.nearDuplicate(hash, img); ok {
+			fmt.Printf("Screenshot is a near-duplicate of %s (hash distance %d), skipping...\n", match, dist)
+			rec.Decision, rec.Match = manifest.NearDuplicate, match
+			return Duplicate
+		}
+	}
+
+	// Claim the next page number; the file is written in the background
+	filename, n, err := p.sequence.Next(prefix, p.cfg.Encoding.Ext())
+	if err != nil {
+		fmt.Printf("Error allocating filename: %v\n", err)
+		rec.Decision, rec.Error = manifest.Failed, err.Error()
+		return Failed
+	}
+	rec.Decision, rec.File, rec.Page, rec.Format = manifest.Saved, filename, n, p.cfg.Encoding.Format
+	p.savedFiles = append(p.savedFiles, filename)
+	p.rememberPage(filename, img)
+	p.samples[filename] = similarity.Sample(img)
+
+	if err := p.index.Add(filename, hash); err != nil {
+		fmt.Printf("Error updating hash index: %v\n", err)
+	}
+
+	// Store as last screenshot
+	p.lastScreenshot = img
+
+	p.queueSave(img, *rec)
+	return Saved
+}
+
+// captureFrame captures a frame and runs the reject classifiers on it. Live
+// captures that are rejected are retried after a short wait; the returned
+// reason is empty once a usable frame was captured.
+func (p *Pipeline) captureFrame() (capture.Frame, string, error) {
+	_, replaying := p.cfg.Source.(*capture.Replay)
+
+	for attempt := 0; ; attempt++ {
+		frame, err := p.cfg.Source.Capture()
+		if err != nil {
+			return frame, "", err
+		}
+
+		reason := p.classify(frame.Image)
+		if reason == "" || replaying || attempt >= p.cfg.RejectRetries {
+			return frame, reason, nil
+		}
+
+		fmt.Printf("Frame rejected (%s), recapturing in %v (%d/%d)\n", reason, p.cfg.RejectWait, attempt+1, p.cfg.RejectRetries)
+		time.Sleep(p.cfg.RejectWait)
+	}
+}
+
+// classify returns why img must not be saved, or "" if it looks like a page.
+func (p *Pipeline) classify(img *image.RGBA) string {
+	for _, c := range p.cfg.Classifiers {
+		if reason := c.Classify(img); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// similar reports whether two captures show the same page, along with the
+// ratio of sampled pixels that differ.
+func (p *Pipeline) similar(img1, img2 *image.RGBA) (bool, float64) {
+	diffRatio := similarity.Diff(img1, img2)
+	return diffRatio < p.cfg.Threshold, diffRatio
+}
+
+// nearDuplicate finds a saved page of the session that img repeats: one
+// whose hash is within HashDistance and whose pixels pass the similarity
+// check too. Sparse pages such as chapter ends differ in few hash bits, so
+// the hash alone would drop them.
+func (p *Pipeline) nearDuplicate(hash phash.Hash, img *image.RGBA) (string, int, bool) {
+	var sample *similarity.Samples
+	for _, e := range p.index.Within(hash, p.cfg.HashDistance) {
+		dist := e.Hash.Distance(hash)
+		saved, ok := p.pageSamples(e.File)
+		if !ok {
+			// Only the hash is known of lossy pages saved before a resume
+			return e.File, dist, true
+		}
+		if sample == nil {
+			s := similarity.Sample(img)
+			sample = &s
+		}
+		diff := saved.Diff(*sample)
+		if diff < p.cfg.Threshold {
+			return e.File, dist, true
+		}
+		fmt.Printf("Hash is close to %s (distance %d), but %.2f%% of pixels differ\n", e.File, dist, diff*100)
+	}
+	return "", 0, false
+}
+
+// pageSamples returns the similarity samples of a saved page, sampling it
+// from disk if it was saved before a resume in a lossless format.
+func (p *Pipeline) pageSamples(file string) (similarity.Samples, bool) {
+	if s, ok := p.samples[file]; ok {
+		return s, true
+	}
+	if !p.cfg.Encoding.Lossless() {
+		return similarity.Samples{}, false
+	}
+	img, err := p.loadCapture(file)
+	if err != nil {
+		fmt.Printf("Error reloading %s, relying on its stored hash: %v\n", file, err)
+		return similarity.Samples{}, false
+	}
+	p.samples[file] = similarity.Sample(img)
+	return p.samples[file], true
+}
+
+// rememberPage keeps img as the capture of the newly saved file, forgetting
+// the oldest one held.
+func (p *Pipeline) rememberPage(file string, img *image.RGBA) {
+	p.recentPages[file] = img
+	if old := len(p.savedFiles) - recentPageCount - 1; old >= 0 {
+		delete(p.recentPages, p.savedFiles[old])
+	}
+}
+
+// loadCapture decodes a saved capture from the capture directory.
+func (p *Pipeline) loadCapture(filename string) (*image.RGBA, error) {
+	file, err := os.Open(filepath.Join(p.cfg.Dir, filename))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return capture.Decode(file)
+}
@@ -0,0 +1,324 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"screenshot-capture/capture"
+	"screenshot-capture/codec"
+	"screenshot-capture/manifest"
+	"screenshot-capture/notify"
+	"screenshot-capture/reject"
+)
+
+// textPage draws a white page of dark "words" in a layout that depends
+// on seed.
+func textPage(seed int64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	rng := rand.New(rand.NewSource(seed))
+	for y := 10; y < 190; y += 12 {
+		for x := 10; x < 290; {
+			word := 8 + rng.Intn(40)
+			for wy := y; wy < y+7; wy++ {
+				for wx := x; wx < min(x+word, 290); wx++ {
+					img.Set(wx, wy, color.Black)
+				}
+			}
+			x += word + 6
+		}
+	}
+	return img
+}
+
+// writeFixtures saves imgs as p_01.png, p_02.png... in a new directory.
+func writeFixtures(t *testing.T, imgs ...*image.RGBA) string {
+	t.Helper()
+	dir := t.TempDir()
+	for i, img := range imgs {
+		f, err := os.Create(filepath.Join(dir, fmt.Sprintf("p_%02d.png", i+1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	return dir
+}
+
+// open starts a pipeline replaying the fixtures in src.
+func open(t *testing.T, src string, cfg Config) *Pipeline {
+	t.Helper()
+	source, err := capture.NewReplay(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { source.Close() })
+
+	cfg.Source = source
+	if cfg.Dir == "" {
+		cfg.Dir = t.TempDir()
+	}
+	cfg.Session, cfg.Profile, cfg.Prefix = "s1", "kindle", "kindle"
+	cfg.Threshold, cfg.HashAlgo, cfg.HashDistance = 0.01, "dhash", 10
+	cfg.Encoding, cfg.Padding = codec.Options{Format: codec.PNG}, 3
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// run captures until the replay ends and returns the result of each
+// capture.
+func run(p *Pipeline) []Result {
+	var results []Result
+	for {
+		result := p.Capture(false)
+		if result == Ended {
+			return results
+		}
+		results = append(results, result)
+	}
+}
+
+// replay runs every fixture in src through a new pipeline.
+func replay(t *testing.T, src string, cfg Config) (*Pipeline, []Result) {
+	t.Helper()
+	p := open(t, src, cfg)
+	return p, run(p)
+}
+
+func records(t *testing.T, dir string) []manifest.Record {
+	t.Helper()
+	recs, err := manifest.Read(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recs
+}
+
+func TestReplay(t *testing.T) {
+	a, b, c := textPage(1), textPage(2), textPage(3)
+	blank := image.NewRGBA(a.Bounds())
+	for i := range blank.Pix {
+		blank.Pix[i] = 255
+	}
+	src := writeFixtures(t, a, a, b, blank, c, a)
+
+	recorder := &notify.Recorder{}
+	p, results := replay(t, src, Config{
+		Classifiers: []reject.Classifier{reject.Blank{MinInk: 0.002}},
+		Notifier:    recorder,
+	})
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Result{Saved, Duplicate, Saved, Rejected, Saved, Duplicate}
+	if !slices.Equal(results, want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+
+	dir := p.cfg.Dir
+	for _, name := range []string{"kindle_001.png", "kindle_002.png", "kindle_003.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s not saved: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "kindle_004.png")); err == nil {
+		t.Errorf("kindle_004.png saved, want only three pages")
+	}
+
+	// Saves are recorded by the workers, so order the records by source
+	decisions := map[string]manifest.Record{}
+	for _, r := range records(t, dir) {
+		if r.Session != "s1" || r.Backend != "replay" {
+			t.Errorf("record %+v has the wrong session or backend", r)
+		}
+		decisions[r.Source] = r
+	}
+	wantRecords := map[string]struct{ decision, file, match string }{
+		"p_01.png": {manifest.Saved, "kindle_001.png", ""},
+		"p_02.png": {manifest.Duplicate, "", ""},
+		"p_03.png": {manifest.Saved, "kindle_002.png", ""},
+		"p_04.png": {manifest.Rejected, "", ""},
+		"p_05.png": {manifest.Saved, "kindle_003.png", ""},
+		"p_06.png": {manifest.NearDuplicate, "", "kindle_001.png"},
+	}
+	for source, w := range wantRecords {
+		r, ok := decisions[source]
+		if !ok {
+			t.Errorf("no record of %s", source)
+			continue
+		}
+		if r.Decision != w.decision || r.File != w.file || r.Match != w.match {
+			t.Errorf("%s recorded as %s %q (match %q), want %s %q (match %q)", source, r.Decision, r.File, r.Match, w.decision, w.file, w.match)
+		}
+	}
+
+	stats := p.Stats()
+	if stats.Saved != 3 || stats.Duplicates != 2 || stats.Rejected != 1 || stats.LastFile != "kindle_003.png" {
+		t.Errorf("Stats() = %+v", stats)
+	}
+	if events := recorder.Events(); len(events) != len(want) {
+		t.Errorf("%d notifications, want %d", len(events), len(want))
+	}
+}
+
+func TestUndo(t *testing.T) {
+	a, b := textPage(1), textPage(2)
+	src := writeFixtures(t, a, b)
+
+	p, _ := replay(t, src, Config{})
+	dir := p.cfg.Dir
+	p.Undo()
+
+	if _, err := os.Stat(filepath.Join(dir, "kindle_002.png")); err == nil {
+		t.Errorf("kindle_002.png still there after undo")
+	}
+	if _, saved := p.Frames(); saved == nil || !slices.Equal(saved.Pix, a.Pix) {
+		t.Errorf("undo did not restore the first page as the reference")
+	}
+	if stats := p.Stats(); stats.Saved != 1 || stats.LastFile != "kindle_001.png" {
+		t.Errorf("Stats() after undo = %+v", stats)
+	}
+	p.Close()
+
+	recs := records(t, dir)
+	if last := recs[len(recs)-1]; last.Decision != manifest.Undone || last.File != "kindle_002.png" {
+		t.Errorf("last record = %+v, want kindle_002.png undone", last)
+	}
+
+	// The freed number is handed out again, and the undone page is no
+	// longer a duplicate
+	p = open(t, writeFixtures(t, b), Config{Dir: dir})
+	p.Resume()
+	results := run(p)
+	p.Close()
+	if !slices.Equal(results, []Result{Saved}) {
+		t.Errorf("recapturing the undone page = %v, want saved", results)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "kindle_002.png")); err != nil {
+		t.Errorf("undone page not saved again as kindle_002.png: %v", err)
+	}
+}
+
+func TestResume(t *testing.T) {
+	a, b := textPage(1), textPage(2)
+	p, _ := replay(t, writeFixtures(t, a, b), Config{})
+	p.Close()
+
+	resumed := open(t, writeFixtures(t, b), Config{Dir: p.cfg.Dir})
+	defer resumed.Close()
+	resumed.Resume()
+
+	if stats := resumed.Stats(); stats.Saved != 2 || stats.LastFile != "kindle_002.png" {
+		t.Errorf("Stats() after Resume = %+v", stats)
+	}
+	// The last page before the restart is the dedup reference again
+	if result := resumed.Capture(false); result != Duplicate {
+		t.Errorf("recapturing the last page after Resume = %v, want duplicate", result)
+	}
+}
+
+// spread draws a near-blank two-column spread with a few lines of words,
+// such as a chapter end or front matter. Such pages differ in few hash bits.
+func spread(seed int64, lines int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 600, 400))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	rng := rand.New(rand.NewSource(seed))
+	for _, column := range []int{40, 330} {
+		for line := 0; line < lines; line++ {
+			y := 40 + 14*line
+			for x := column; x < column+230; {
+				word := 10 + rng.Intn(40)
+				for wy := y; wy < y+8; wy++ {
+					for wx := x; wx < min(x+word, column+230); wx++ {
+						img.Set(wx, wy, color.Black)
+					}
+				}
+				x += word + 8
+			}
+		}
+	}
+	return img
+}
+
+func TestSparsePages(t *testing.T) {
+	// Every one of these is within 10 bits of an earlier one
+	var imgs []*image.RGBA
+	for _, seed := range []int64{1, 2, 5, 6, 7} {
+		imgs = append(imgs, spread(seed, 3))
+	}
+	p, results := replay(t, writeFixtures(t, imgs...), Config{})
+	p.Close()
+	for i, result := range results {
+		if result != Saved {
+			t.Errorf("sparse page %d: %v, want saved", i+1, result)
+		}
+	}
+
+	// A re-capture of one of them is still caught
+	p, results = replay(t, writeFixtures(t, imgs[0], imgs[1], imgs[0]), Config{})
+	p.Close()
+	if want := []Result{Saved, Saved, Duplicate}; !slices.Equal(results, want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+}
+
+// stalledNotifier blocks skipped-page notifications until release is
+// closed, signalling stalled when one starts.
+type stalledNotifier struct {
+	stalled, release chan struct{}
+}
+
+func (n stalledNotifier) Notify(e notify.Event, _ string) error {
+	if e == notify.Skipped {
+		close(n.stalled)
+		<-n.release
+	}
+	return nil
+}
+
+func TestStalledNotifier(t *testing.T) {
+	a := textPage(1)
+	n := stalledNotifier{stalled: make(chan struct{}), release: make(chan struct{})}
+	p := open(t, writeFixtures(t, a, a), Config{Notifier: n})
+	defer p.Close()
+
+	p.Capture(false)
+	done := make(chan Result)
+	go func() { done <- p.Capture(false) }()
+	<-n.stalled
+
+	unlocked := make(chan struct{})
+	go func() {
+		p.Frames()
+		close(unlocked)
+	}()
+	select {
+	case <-unlocked:
+	case <-time.After(2 * time.Second):
+		t.Errorf("a stalled notifier holds the capture state")
+	}
+
+	close(n.release)
+	if result := <-done; result != Duplicate {
+		t.Errorf("Capture() = %v, want duplicate", result)
+	}
+}
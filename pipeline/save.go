@@ -0,0 +1,128 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+
+	"screenshot-capture/codec"
+	"screenshot-capture/manifest"
+	"screenshot-capture/notify"
+)
+
+// queueSave hands a capture to the save workers. It blocks while the queue
+// is full, which slows auto capture down to the speed of the disk.
+func (p *Pipeline) queueSave(img *image.RGBA, rec manifest.Record) {
+	p.pending.Add(1)
+	p.queue <- saveJob{img: img, rec: rec}
+}
+
+func (p *Pipeline) saveWorker() {
+	defer p.workers.Done()
+
+	for job := range p.queue {
+		p.save(job)
+		p.pending.Done()
+	}
+}
+
+// save writes a queued capture, then announces and records the outcome.
+func (p *Pipeline) save(job saveJob) {
+	rec := job.rec
+	path := filepath.Join(p.cfg.Dir, rec.File)
+	event, message := notify.Saved, "Saved "+rec.File
+
+	if err := writeCapture(path, job.img, p.cfg.Encoding); err != nil {
+		fmt.Printf("Error saving %s: %v\n", path, err)
+		// Drop the hash so the page can be captured again; the rest of
+		// the capture state is rolled back by the next capture
+		if err := p.index.Remove(rec.File); err != nil {
+			fmt.Printf("Error updating hash index: %v\n", err)
+		}
+		p.failedMu.Lock()
+		p.failedSaves = append(p.failedSaves, job)
+		p.failedMu.Unlock()
+		rec.Decision, rec.Error = manifest.Failed, err.Error()
+		event, message = notify.Failed, "Save failed: "+err.Error()
+	} else {
+		fmt.Printf("Screenshot saved to: %s\n", path)
+	}
+
+	p.statsMu.Lock()
+	if rec.Decision == manifest.Saved {
+		p.stats.Saved++
+		p.stats.LastFile = rec.File
+	} else {
+		p.stats.Failed++
+	}
+	p.statsMu.Unlock()
+
+	if err := p.cfg.Notifier.Notify(event, message); err != nil {
+		fmt.Printf("Error sending notification: %v\n", err)
+	}
+	if err := p.manifest.Write(rec); err != nil {
+		fmt.Printf("Error writing manifest: %v\n", err)
+	}
+}
+
+// writeCapture encodes img into a temporary file next to path and moves it
+// into place, so an interrupted save never leaves a truncated or empty
+// image. An existing file at path is never replaced.
+func writeCapture(path string, img *image.RGBA, encoding codec.Options) error {
+	// The leading dot and .tmp extension keep it out of directory scans
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := file.Name()
+
+	err = codec.Encode(file, img, encoding)
+	if err != nil {
+		err = fmt.Errorf("failed to encode %s: %w", encoding.Format, err)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = linkInPlace(tmp, path)
+	}
+	os.Remove(tmp)
+	return err
+}
+
+// linkInPlace gives tmp the name path unless that is taken. Hard links make
+// the check atomic; filesystems without them fall back to checking first.
+func linkInPlace(tmp, path string) error {
+	err := os.Link(tmp, path)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s appeared while it was being saved", filepath.Base(path))
+	}
+	if err == nil {
+		return nil
+	}
+
+	if _, statErr := os.Lstat(path); statErr == nil {
+		return fmt.Errorf("%s appeared while it was being saved", filepath.Base(path))
+	}
+	return os.Rename(tmp, path)
+}
+
+// removeStaleTemps deletes the temporary files of saves that were cut off
+// by a kill.
+func (p *Pipeline) removeStaleTemps() {
+	stale, _ := filepath.Glob(filepath.Join(p.cfg.Dir, ".*.tmp"))
+	for _, path := range stale {
+		os.Remove(path)
+	}
+	if len(stale) > 0 {
+		fmt.Printf("Removed %d temporary files left by an interrupted run\n", len(stale))
+	}
+}
@@ -0,0 +1,208 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"screenshot-capture/codec"
+	"screenshot-capture/manifest"
+	"screenshot-capture/pages"
+)
+
+// Undo deletes the most recent capture of the session and makes the page
+// before it the dedup reference again. Repeated undos step further back;
+// the next capture reuses the freed file number.
+func (p *Pipeline) Undo() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// A capture still in the queue would be written after its deletion
+	p.pending.Wait()
+	p.rollBackFailedSaves()
+
+	if len(p.savedFiles) == 0 {
+		fmt.Println("Nothing to undo")
+		return
+	}
+
+	filename := p.savedFiles[len(p.savedFiles)-1]
+	path := filepath.Join(p.cfg.Dir, filename)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("Error deleting %s: %v\n", path, err)
+		return
+	}
+	p.savedFiles = p.savedFiles[:len(p.savedFiles)-1]
+	delete(p.recentPages, filename)
+	delete(p.samples, filename)
+	fmt.Printf("Deleted %s\n", path)
+
+	if prefix, n, ok := pages.Number(filename); ok {
+		p.sequence.Release(prefix, n)
+	}
+
+	if err := p.index.Remove(filename); err != nil {
+		fmt.Printf("Error updating hash index: %v\n", err)
+	}
+
+	rec := manifest.Record{Time: time.Now(), Backend: p.cfg.Source.Name(), Decision: manifest.Undone, File: filename}
+	if err := p.manifest.Write(rec); err != nil {
+		fmt.Printf("Error writing manifest: %v\n", err)
+	}
+
+	// Compare the next capture against the last page that was kept
+	previous := p.restoreReference()
+	if p.lastScreenshot != nil {
+		fmt.Printf("Comparing next capture against %s\n", previous)
+	}
+
+	p.statsMu.Lock()
+	p.stats.Saved--
+	p.stats.LastFile, p.latest = previous, p.lastScreenshot
+	p.statsMu.Unlock()
+}
+
+// rollBackFailedSaves forgets the captures whose save failed, so that their
+// pages are neither undone nor taken for duplicates when captured again,
+// and frees their numbers where possible. Called with mu held.
+func (p *Pipeline) rollBackFailedSaves() {
+	p.failedMu.Lock()
+	failed := p.failedSaves
+	p.failedSaves = nil
+	p.failedMu.Unlock()
+
+	if len(failed) == 0 {
+		return
+	}
+
+	// Newest first, as only the last number handed out can be released
+	sort.Slice(failed, func(i, j int) bool { return failed[i].rec.Page > failed[j].rec.Page })
+
+	reference := false
+	for _, job := range failed {
+		file := job.rec.File
+		fmt.Printf("Forgetting %s, which could not be saved\n", file)
+		p.savedFiles = slices.DeleteFunc(p.savedFiles, func(f string) bool { return f == file })
+		delete(p.recentPages, file)
+		delete(p.samples, file)
+		if prefix, n, ok := pages.Number(file); ok {
+			p.sequence.Release(prefix, n)
+		}
+		if job.img == p.lastScreenshot {
+			reference = true
+		}
+	}
+	if !reference {
+		return
+	}
+
+	previous := p.restoreReference()
+	p.statsMu.Lock()
+	p.stats.LastFile, p.latest = previous, p.lastScreenshot
+	p.statsMu.Unlock()
+}
+
+// restoreReference makes the last page still saved the dedup reference
+// again and returns its file name, or "" if none is left. Pages no longer
+// held in memory are reloaded from disk if the format is lossless.
+func (p *Pipeline) restoreReference() string {
+	p.lastScreenshot = nil
+	if len(p.savedFiles) == 0 {
+		return ""
+	}
+
+	previous := p.savedFiles[len(p.savedFiles)-1]
+	img, ok := p.recentPages[previous]
+	if !ok {
+		// A re-decoded JPEG or grayscale file does not compare like a fresh
+		// capture; the hash index still catches a re-capture of the page
+		if !p.cfg.Encoding.Lossless() {
+			return previous
+		}
+		var err error
+		if img, err = p.loadCapture(previous); err != nil {
+			fmt.Printf("Error reloading %s, relying on its stored hash: %v\n", previous, err)
+			return previous
+		}
+	}
+	p.lastScreenshot = img
+	return previous
+}
+
+// Resume rebuilds the state of the session from the manifest: its saved
+// pages, so undo can step back past the restart, its totals, and the last
+// page as the dedup reference. File numbering carries on from the
+// directory scan.
+func (p *Pipeline) Resume() {
+	records, err := manifest.Read(filepath.Join(p.cfg.Dir, ManifestFile))
+	if err != nil {
+		fmt.Printf("Error reading manifest, starting without history: %v\n", err)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.statsMu.Lock()
+	for _, r := range records {
+		if r.Session != p.cfg.Session {
+			continue
+		}
+		switch r.Decision {
+		case manifest.Duplicate, manifest.NearDuplicate:
+			p.stats.Duplicates++
+		case manifest.Rejected:
+			p.stats.Rejected++
+		case manifest.Failed:
+			p.stats.Failed++
+		}
+		if r.Diff != nil {
+			p.stats.LastDiff = r.Diff
+		}
+	}
+	p.savedFiles = manifest.SavedFiles(records, p.cfg.Session)
+	p.stats.Saved = len(p.savedFiles)
+	p.statsMu.Unlock()
+
+	if len(p.savedFiles) == 0 {
+		fmt.Println("No pages saved in this session yet")
+		return
+	}
+	last := p.savedFiles[len(p.savedFiles)-1]
+
+	// A re-decoded JPEG or grayscale file does not compare like a fresh
+	// capture, so lossy pages are matched by their stored hash alone
+	format := codec.Options{Format: codec.PNG}
+	for _, r := range records {
+		if r.File == last && r.Decision == manifest.Saved && r.Format != "" {
+			format.Format = r.Format
+		}
+	}
+	if !format.Lossless() {
+		p.statsMu.Lock()
+		p.stats.LastFile = last
+		p.statsMu.Unlock()
+		fmt.Printf("Continuing after %s (%d pages saved so far, matched by hash)\n", last, len(p.savedFiles))
+		return
+	}
+
+	img, err := p.loadCapture(last)
+	if err != nil {
+		// The hash index still holds the page, so a re-capture of it is
+		// caught as a near-duplicate
+		fmt.Printf("Error reloading %s, relying on its stored hash: %v\n", last, err)
+		return
+	}
+	p.lastScreenshot, p.lastFrame = img, img
+	p.recentPages[last] = img
+
+	p.statsMu.Lock()
+	p.stats.LastFile, p.latest = last, img
+	p.statsMu.Unlock()
+
+	fmt.Printf("Continuing after %s (%d pages saved so far)\n", last, len(p.savedFiles))
+}
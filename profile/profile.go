@@ -0,0 +1,127 @@
+// Package profile bundles the settings that depend on the reader app being
+// captured, so a session only has to name the app.
+package profile
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"screenshot-capture/window"
+)
+
+// Page layouts
+const (
+	Single = "single" // One page per capture
+	Spread = "spread" // Two facing pages, split down the middle
+)
+
+// Profile holds the settings for one reader app.
+type Profile struct {
+	Name string
+
+	// Window matching; an empty Owner matches any app
+	Owner string
+	Title string // Regular expression, empty to match any title
+
+	NextKey   string        // robotgo key name that turns the page
+	Delay     time.Duration // Wait after turning the page
+	Threshold float64       // Different-pixel ratio below which pages count as the same
+
+	// Default content area inside the window, until it is calibrated
+	Insets window.Insets
+
+	// Page layout and the fraction of the page height crop-ocr cuts off
+	// (running headers, page numbers, progress bars) on captures that
+	// calibration has not already trimmed
+	Layout       string
+	TopMargin    float64
+	BottomMargin float64
+}
+
+var builtin = map[string]Profile{
+	"kindle": {
+		Owner:        "Kindle",
+		NextKey:      "right",
+		Delay:        800 * time.Millisecond,
+		Threshold:    0.01,
+		Layout:       Spread,
+		TopMargin:    0.08,
+		BottomMargin: 0.05,
+	},
+	"books": {
+		Owner:        "Books",
+		NextKey:      "right",
+		Delay:        600 * time.Millisecond,
+		Threshold:    0.01,
+		Insets:       window.Insets{Top: 52},
+		Layout:       Spread,
+		TopMargin:    0.06,
+		BottomMargin: 0.05,
+	},
+	"calibre": {
+		Owner:        "calibre",
+		NextKey:      "pagedown",
+		Delay:        500 * time.Millisecond,
+		Threshold:    0.01,
+		Layout:       Single,
+		TopMargin:    0.03,
+		BottomMargin: 0.03,
+	},
+	// Web readers: browsers differ per user, so -owner, -title or -pid has
+	// to name the window. Pages are slower to render and often carry
+	// animated chrome.
+	"browser": {
+		NextKey:      "right",
+		Delay:        1200 * time.Millisecond,
+		Threshold:    0.02,
+		Insets:       window.Insets{Top: 88},
+		Layout:       Single,
+		TopMargin:    0.04,
+		BottomMargin: 0.04,
+	},
+	// Preview, Evince, Okular and friends all show the file name in the title
+	"pdf": {
+		Title:     `(?i)\.pdf\b`,
+		NextKey:   "pagedown",
+		Delay:     400 * time.Millisecond,
+		Threshold: 0.005,
+		Layout:    Single,
+	},
+}
+
+// Lookup returns the built-in profile called name.
+func Lookup(name string) (Profile, error) {
+	p, ok := builtin[strings.ToLower(name)]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q (known: %s)", name, strings.Join(Names(), ", "))
+	}
+	p.Name = strings.ToLower(name)
+	return p, nil
+}
+
+// Names lists the built-in profiles.
+func Names() []string {
+	names := make([]string, 0, len(builtin))
+	for name := range builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Matcher returns the window matcher for the profile. Its Name, the profile
+// name, doubles as the capture file prefix.
+func (p Profile) Matcher() (window.Matcher, error) {
+	m := window.Matcher{Name: p.Name, Owner: p.Owner}
+	if p.Title != "" {
+		re, err := regexp.Compile(p.Title)
+		if err != nil {
+			return m, fmt.Errorf("profile %s: invalid title pattern: %w", p.Name, err)
+		}
+		m.Title = re
+	}
+	return m, nil
+}
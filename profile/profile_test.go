@@ -0,0 +1,98 @@
+package profile
+
+import (
+	"image"
+	"slices"
+	"strings"
+	"testing"
+
+	"screenshot-capture/window"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name     string
+		want     string
+		nextKey  string
+		layout   string
+		hasTitle bool
+	}{
+		{"kindle", "kindle", "right", Spread, false},
+		{"Kindle", "kindle", "right", Spread, false},
+		{"calibre", "calibre", "pagedown", Single, false},
+		{"PDF", "pdf", "pagedown", Single, true},
+	}
+	for _, tt := range tests {
+		p, err := Lookup(tt.name)
+		if err != nil {
+			t.Errorf("Lookup(%q): %v", tt.name, err)
+			continue
+		}
+		if p.Name != tt.want || p.NextKey != tt.nextKey || p.Layout != tt.layout || (p.Title != "") != tt.hasTitle {
+			t.Errorf("Lookup(%q) = %+v", tt.name, p)
+		}
+	}
+
+	_, err := Lookup("kobo")
+	if err == nil {
+		t.Fatalf("Lookup(%q) succeeded, want error", "kobo")
+	}
+	// The error lists the profiles there are
+	if !strings.Contains(err.Error(), strings.Join(Names(), ", ")) {
+		t.Errorf("Lookup(%q) = %q, want the known profiles listed", "kobo", err)
+	}
+}
+
+func TestNames(t *testing.T) {
+	names := Names()
+	if !slices.IsSorted(names) || len(names) != len(builtin) {
+		t.Errorf("Names() = %q, want every profile, sorted", names)
+	}
+	for _, name := range names {
+		if _, err := Lookup(name); err != nil {
+			t.Errorf("Lookup(%q): %v", name, err)
+		}
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	win := func(owner, title string) window.Info {
+		return window.Info{Owner: owner, Title: title, Bounds: image.Rect(0, 0, 800, 600)}
+	}
+
+	tests := []struct {
+		profile string
+		w       window.Info
+		want    bool
+	}{
+		{"kindle", win("Kindle", "Some Book"), true},
+		{"kindle", win("kindle-reader", ""), true},
+		{"kindle", win("Books", "Some Book"), false},
+		{"pdf", win("Preview", "paper.PDF"), true},
+		{"pdf", win("evince", "paper.pdf — Document Viewer"), true},
+		{"pdf", win("evince", "paper.pdfx"), false},
+		{"pdf", win("Preview", "notes.txt"), false},
+		{"browser", win("firefox", "anything"), true},
+	}
+	for _, tt := range tests {
+		p, err := Lookup(tt.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := p.Matcher()
+		if err != nil {
+			t.Fatalf("profile %s: Matcher(): %v", tt.profile, err)
+		}
+		if m.Name != tt.profile {
+			t.Errorf("profile %s: Matcher().Name = %q", tt.profile, m.Name)
+		}
+		if got := m.Match(tt.w); got != tt.want {
+			t.Errorf("profile %s: Match(%q, %q) = %v, want %v", tt.profile, tt.w.Owner, tt.w.Title, got, tt.want)
+		}
+	}
+
+	bad := Profile{Name: "broken", Title: `(unclosed`}
+	if _, err := bad.Matcher(); err == nil || !strings.Contains(err.Error(), "profile broken") {
+		t.Errorf("Matcher() with title %q = %v, want an error naming the profile", bad.Title, err)
+	}
+}
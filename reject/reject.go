@@ -0,0 +1,291 @@
+// Package reject recognises frames that must not be saved as pages: blank or
+// loading screens, and known UI overlays such as "Are you still reading?"
+// dialogs.
+package reject
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Classifier flags unusable frames. Reason is empty for a usable frame.
+type Classifier interface {
+	Classify(img *image.RGBA) (reason string)
+}
+
+// Blank flags uniform or nearly empty frames: all-white loading screens, or
+// a spinner on an otherwise empty page.
+type Blank struct {
+	// MinInk is the minimum fraction of pixels that must differ clearly
+	// from the background for the frame to count as a page.
+	MinInk float64
+}
+
+func (b Blank) Classify(img *image.RGBA) string {
+	bounds := img.Bounds()
+	const step = 4 // sample every 4th pixel in both directions
+
+	var lum []uint8
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			lum = append(lum, luminance(img, x, y))
+		}
+	}
+	if len(lum) == 0 {
+		return "empty frame"
+	}
+
+	// The median is the background colour on any text page
+	sorted := append([]uint8(nil), lum...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	background := int(sorted[len(sorted)/2])
+
+	ink := 0
+	for _, l := range lum {
+		if d := int(l) - background; d > 48 || d < -48 {
+			ink++
+		}
+	}
+
+	ratio := float64(ink) / float64(len(lum))
+	if ratio < b.MinInk {
+		return fmt.Sprintf("blank frame (%.3f%% ink)", ratio*100)
+	}
+	return ""
+}
+
+// Overlay flags frames containing any of a set of reference images, matched
+// on downscaled grayscale copies.
+type Overlay struct {
+	Templates []Template
+	// MaxDiff is the mean absolute luminance difference (0-255) below
+	// which a template counts as present.
+	MaxDiff float64
+}
+
+// Template is a reference image of a UI element to reject.
+type Template struct {
+	Name string
+	gray *image.Gray // downscaled
+}
+
+// overlayScale is the downscale factor for template matching. Overlays are
+// large dialogs, so matching at 1/8 resolution is plenty and keeps the
+// sliding search cheap.
+const overlayScale = 8
+
+// overlayCandidates is how many of the best coarse positions are searched
+// again at every pixel offset. The coarse search only sees the frame on its
+// own 8x8 grid, where a dialog off that grid matches less well.
+const overlayCandidates = 4
+
+// LoadTemplates reads every PNG or JPEG in dir as an overlay template. The
+// references should be cropped from real captures so the scale matches.
+func LoadTemplates(dir string) ([]Template, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read overlay templates: %w", err)
+	}
+
+	var templates []Template
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".png", ".jpg", ".jpeg":
+		default:
+			continue
+		}
+
+		file, err := os.Open(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		img, _, err := image.Decode(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode template %s: %w", entry.Name(), err)
+		}
+
+		rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+		gray := newIntegral(rgba).downscale(overlayScale)
+		if gray.Bounds().Dx() < 2 || gray.Bounds().Dy() < 2 {
+			return nil, fmt.Errorf("template %s is too small to match", entry.Name())
+		}
+		templates = append(templates, Template{Name: entry.Name(), gray: gray})
+	}
+
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("no overlay templates found in %s", dir)
+	}
+	return templates, nil
+}
+
+func (o Overlay) Classify(img *image.RGBA) string {
+	if len(o.Templates) == 0 {
+		return ""
+	}
+
+	lum := newIntegral(img)
+	frame := lum.downscale(overlayScale)
+	for _, t := range o.Templates {
+		if diff, ok := bestMatch(lum, frame, t.gray, o.MaxDiff); ok {
+			return fmt.Sprintf("overlay %s (mean diff %.1f)", t.Name, diff)
+		}
+	}
+	return ""
+}
+
+// bestMatch slides tmpl over the downscaled frame, then searches around the
+// best positions at every pixel offset of lum. It returns the lowest mean
+// absolute difference found, if it is below maxDiff.
+func bestMatch(lum *integral, frame, tmpl *image.Gray, maxDiff float64) (float64, bool) {
+	tw, th := tmpl.Bounds().Dx(), tmpl.Bounds().Dy()
+	if tw > frame.Bounds().Dx() || th > frame.Bounds().Dy() {
+		return 0, false
+	}
+
+	pixels := tw * th
+	limit := int(maxDiff * float64(pixels))
+	best := math.MaxInt
+
+	for _, c := range coarseCandidates(frame, tmpl, overlayCandidates) {
+		// The dialog lies within a block of the coarse position
+		for y := c.Y*overlayScale - overlayScale + 1; y < (c.Y+1)*overlayScale; y++ {
+			for x := c.X*overlayScale - overlayScale + 1; x < (c.X+1)*overlayScale; x++ {
+				if x < 0 || y < 0 || x+tw*overlayScale > lum.w || y+th*overlayScale > lum.h {
+					continue
+				}
+				if sum := lum.diff(x, y, tmpl, min(limit, best)); sum < best {
+					best = sum
+				}
+			}
+		}
+	}
+
+	mean := float64(best) / float64(pixels)
+	return mean, best < limit
+}
+
+// coarseCandidates returns the n positions of frame where tmpl differs
+// least, best first.
+func coarseCandidates(frame, tmpl *image.Gray, n int) []image.Point {
+	fw, fh := frame.Bounds().Dx(), frame.Bounds().Dy()
+	tw, th := tmpl.Bounds().Dx(), tmpl.Bounds().Dy()
+
+	type candidate struct {
+		at  image.Point
+		sum int
+	}
+	var best []candidate
+
+	for oy := 0; oy+th <= fh; oy++ {
+		for ox := 0; ox+tw <= fw; ox++ {
+			worst := math.MaxInt
+			if len(best) == n {
+				worst = best[n-1].sum
+			}
+			sum := 0
+			for y := 0; y < th && sum < worst; y++ {
+				frow := frame.Pix[(oy+y)*frame.Stride+ox:]
+				trow := tmpl.Pix[y*tmpl.Stride:]
+				for x := 0; x < tw; x++ {
+					d := int(frow[x]) - int(trow[x])
+					if d < 0 {
+						d = -d
+					}
+					sum += d
+				}
+			}
+			if sum >= worst {
+				continue
+			}
+
+			i := sort.Search(len(best), func(i int) bool { return best[i].sum > sum })
+			if len(best) < n {
+				best = append(best, candidate{})
+			}
+			copy(best[i+1:], best[i:])
+			best[i] = candidate{image.Pt(ox, oy), sum}
+		}
+	}
+
+	points := make([]image.Point, len(best))
+	for i, c := range best {
+		points[i] = c.at
+	}
+	return points
+}
+
+// integral is a summed-area table of the luminance of an image, so the mean
+// of any block can be read in constant time.
+type integral struct {
+	w, h int
+	sum  []int // (w+1) x (h+1), with a zero first row and column
+}
+
+func newIntegral(img *image.RGBA) *integral {
+	b := img.Bounds()
+	s := &integral{w: b.Dx(), h: b.Dy(), sum: make([]int, (b.Dx()+1)*(b.Dy()+1))}
+	stride := s.w + 1
+
+	for y := 0; y < s.h; y++ {
+		row := 0
+		for x := 0; x < s.w; x++ {
+			row += int(luminance(img, b.Min.X+x, b.Min.Y+y))
+			s.sum[(y+1)*stride+x+1] = s.sum[y*stride+x+1] + row
+		}
+	}
+	return s
+}
+
+// block returns the mean luminance of the size x size block at x, y.
+func (s *integral) block(x, y, size int) uint8 {
+	stride := s.w + 1
+	top, bottom := y*stride, (y+size)*stride
+	total := s.sum[bottom+x+size] - s.sum[bottom+x] - s.sum[top+x+size] + s.sum[top+x]
+	return uint8(total / (size * size))
+}
+
+// downscale averages factor x factor blocks into a grayscale image.
+func (s *integral) downscale(factor int) *image.Gray {
+	w, h := s.w/factor, s.h/factor
+	out := image.NewGray(image.Rect(0, 0, w, h))
+	for by := 0; by < h; by++ {
+		for bx := 0; bx < w; bx++ {
+			out.Pix[by*out.Stride+bx] = s.block(bx*factor, by*factor, factor)
+		}
+	}
+	return out
+}
+
+// diff returns the summed absolute difference between tmpl and the frame
+// downscaled from x, y, giving up once it reaches limit.
+func (s *integral) diff(x, y int, tmpl *image.Gray, limit int) int {
+	tw, th := tmpl.Bounds().Dx(), tmpl.Bounds().Dy()
+	sum := 0
+	for ty := 0; ty < th && sum < limit; ty++ {
+		trow := tmpl.Pix[ty*tmpl.Stride:]
+		for tx := 0; tx < tw; tx++ {
+			d := int(s.block(x+tx*overlayScale, y+ty*overlayScale, overlayScale)) - int(trow[tx])
+			if d < 0 {
+				d = -d
+			}
+			sum += d
+		}
+	}
+	return sum
+}
+
+func luminance(img *image.RGBA, x, y int) uint8 {
+	i := img.PixOffset(x, y)
+	r, g, b := int(img.Pix[i]), int(img.Pix[i+1]), int(img.Pix[i+2])
+	return uint8((299*r + 587*g + 114*b) / 1000)
+}
@@ -0,0 +1,167 @@
+package reject
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fill paints r of img in c.
+func fill(img *image.RGBA, r image.Rectangle, c color.Color) {
+	draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// textPage draws a white page of dark "words" in a layout that depends on
+// seed.
+func textPage(w, h int, seed int64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	fill(img, img.Bounds(), color.White)
+	rng := rand.New(rand.NewSource(seed))
+	for y := 20; y+8 < h-20; y += 14 {
+		for x := 20; x < w-20; {
+			word := 10 + rng.Intn(40)
+			fill(img, image.Rect(x, y, min(x+word, w-20), y+8), color.Black)
+			x += word + 8
+		}
+	}
+	return img
+}
+
+// dialog draws a framed box with a title bar, a few lines of text and a
+// button, laid out by seed.
+func dialog(seed int64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 180, 100))
+	fill(img, img.Bounds(), color.Gray{60})
+	fill(img, image.Rect(3, 3, 177, 97), color.Gray{230})
+	fill(img, image.Rect(3, 3, 177, 21), color.Gray{120})
+	rng := rand.New(rand.NewSource(seed))
+	for y := 30; y < 60; y += 11 {
+		for x := 12; x < 168; {
+			word := 6 + rng.Intn(30)
+			fill(img, image.Rect(x, y, min(x+word, 168), y+6), color.Gray{20})
+			x += word + 5
+		}
+	}
+	fill(img, image.Rect(110+rng.Intn(20), 70, 165, 90), color.Gray{40})
+	return img
+}
+
+func TestBlank(t *testing.T) {
+	white := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	fill(white, white.Bounds(), color.White)
+
+	spinner := image.NewRGBA(white.Bounds())
+	fill(spinner, spinner.Bounds(), color.White)
+	fill(spinner, image.Rect(196, 146, 204, 154), color.Black)
+
+	dark := image.NewRGBA(white.Bounds())
+	fill(dark, dark.Bounds(), color.Black)
+
+	tests := []struct {
+		name  string
+		img   *image.RGBA
+		blank bool
+	}{
+		{"white", white, true},
+		{"dark", dark, true},
+		{"spinner", spinner, true},
+		{"text", textPage(400, 300, 1), false},
+		{"empty", image.NewRGBA(image.Rect(0, 0, 0, 0)), true},
+	}
+	b := Blank{MinInk: 0.002}
+	for _, tt := range tests {
+		if reason := b.Classify(tt.img); (reason != "") != tt.blank {
+			t.Errorf("Classify(%s) = %q, want blank %v", tt.name, reason, tt.blank)
+		}
+	}
+}
+
+// loadDialog saves dialog(seed) as a template and loads it back.
+func loadDialog(t *testing.T, seed int64) []Template {
+	t.Helper()
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "still-reading.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, dialog(seed)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a template"), 0644)
+
+	templates, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 1 || templates[0].Name != "still-reading.png" {
+		t.Fatalf("LoadTemplates() = %d templates, want still-reading.png", len(templates))
+	}
+	return templates
+}
+
+func TestOverlay(t *testing.T) {
+	o := Overlay{Templates: loadDialog(t, 1), MaxDiff: 12}
+
+	// Every phase of the 8x8 grid the coarse search works on
+	offsets := []image.Point{
+		{0, 0}, {1, 0}, {0, 1}, {3, 5}, {4, 4}, {7, 7}, {5, 2},
+		{101, 57}, {116, 203}, {213, 131}, {420, 300},
+	}
+	for _, at := range offsets {
+		frame := textPage(600, 400, 2)
+		d := dialog(1)
+		draw.Draw(frame, d.Bounds().Add(at), d, image.Point{}, draw.Src)
+		if reason := o.Classify(frame); reason == "" {
+			t.Errorf("Classify() with the dialog at %v = \"\", want a match", at)
+		}
+	}
+
+	misses := map[string]*image.RGBA{
+		"text page": textPage(600, 400, 2),
+		"blank":     image.NewRGBA(image.Rect(0, 0, 600, 400)),
+		"too small": textPage(120, 80, 2),
+	}
+	// The same dialog in night mode
+	other := textPage(600, 400, 3)
+	d := dialog(1)
+	for i := range d.Pix {
+		if i%4 != 3 {
+			d.Pix[i] = 255 - d.Pix[i]
+		}
+	}
+	draw.Draw(other, d.Bounds().Add(image.Pt(203, 141)), d, image.Point{}, draw.Src)
+	misses["night mode dialog"] = other
+
+	for name, frame := range misses {
+		if reason := o.Classify(frame); reason != "" {
+			t.Errorf("Classify(%s) = %q, want no match", name, reason)
+		}
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadTemplates(dir); err == nil {
+		t.Errorf("LoadTemplates of an empty directory succeeded")
+	}
+
+	f, err := os.Create(filepath.Join(dir, "tiny.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	f.Close()
+	if _, err := LoadTemplates(dir); err == nil {
+		t.Errorf("LoadTemplates with a 10x10 template succeeded")
+	}
+
+	if _, err := LoadTemplates(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("LoadTemplates of a missing directory succeeded")
+	}
+}
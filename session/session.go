@@ -0,0 +1,60 @@
+// Package session remembers how the last capture session in a directory was
+// started, so an interrupted book can be resumed with the same settings.
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File is the name of the session state file in the capture directory.
+const File = "session.json"
+
+// State describes a capture session.
+type State struct {
+	ID      string    `json:"id"`
+	Profile string    `json:"profile"`
+	Started time.Time `json:"started"`
+	// Args are the flags the session was started with, as "-name=value"
+	Args []string `json:"args"`
+}
+
+// Load reads the state of the last session in dir. It reports false if no
+// session was recorded there.
+func Load(dir string) (State, bool, error) {
+	data, err := os.ReadFile(filepath.Join(dir, File))
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, false, nil
+	}
+	if err != nil {
+		return State{}, false, fmt.Errorf("failed to read session state: %w", err)
+	}
+
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return State{}, false, fmt.Errorf("invalid session state %s: %w", File, err)
+	}
+	return s, true, nil
+}
+
+// Save records s as the last session in dir.
+func Save(dir string, s State) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash can't truncate the state
+	path := filepath.Join(dir, File)
+	if err := os.WriteFile(path+".tmp", append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to save session state: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to save session state: %w", err)
+	}
+	return nil
+}
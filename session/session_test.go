@@ -0,0 +1,75 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	want := State{
+		ID:      "20260102-150405",
+		Profile: "kindle",
+		Started: time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC),
+		Args:    []string{"-auto=true", "-threshold=0.02", "-next-key=pagedown"},
+	}
+	if err := Save(dir, want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, found, err := Load(dir)
+	if err != nil || !found {
+		t.Fatalf("Load() = %v, %v", found, err)
+	}
+	if got.ID != want.ID || got.Profile != want.Profile || !got.Started.Equal(want.Started) || !slices.Equal(got.Args, want.Args) {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+
+	// Saving again replaces the state and leaves no temporary file
+	want.Profile = "pdf"
+	if err := Save(dir, want); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := Load(dir); got.Profile != "pdf" {
+		t.Errorf("Load() after a second Save = %+v, want profile pdf", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, File+".tmp")); err == nil {
+		t.Errorf("Save() left %s.tmp behind", File)
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	s, found, err := Load(t.TempDir())
+	if err != nil || found {
+		t.Errorf("Load() without %s = %+v, %v, %v, want not found", File, s, found, err)
+	}
+
+	// A capture directory that isn't there yet has no session either
+	if _, found, err := Load(filepath.Join(t.TempDir(), "missing")); err != nil || found {
+		t.Errorf("Load() of a missing directory = %v, %v, want not found", found, err)
+	}
+}
+
+func TestLoadCorrupt(t *testing.T) {
+	for _, data := range []string{"", "{", `{"id": 3}`, "not json"} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, File), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, found, err := Load(dir); err == nil || found {
+			t.Errorf("Load() of %q = %v, %v, want an error", data, found, err)
+		}
+	}
+
+	// An unreadable state is an error, not a missing session
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, File), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := Load(dir); err == nil || found {
+		t.Errorf("Load() with %s a directory = %v, %v, want an error", File, found, err)
+	}
+}
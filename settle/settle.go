@@ -0,0 +1,79 @@
+// Package settle follows frames sampled from the screen to tell when the
+// page has changed and then held still, so a turned page is captured only
+// once it has finished drawing.
+package settle
+
+import (
+	"image"
+	"time"
+
+	"screenshot-capture/similarity"
+)
+
+// Settings control when a page counts as settled.
+type Settings struct {
+	// Threshold is the similarity.Diff below which two frames show the
+	// same page
+	Threshold float64
+	// Frames is the number of consecutive unchanged samples that mean the
+	// page has settled
+	Frames int
+	// MinGap is the minimum time between two settled pages, measured from
+	// the last Rebase, so animations that pause briefly don't settle twice
+	MinGap time.Duration
+}
+
+// Detector compares each sample against a baseline, the page shown before,
+// until it differs, and then against the previous sample until it holds
+// still for Settings.Frames samples.
+type Detector struct {
+	settings Settings
+	baseline *image.RGBA
+	previous *image.RGBA
+	changed  bool
+	stable   int
+	rebased  time.Time
+}
+
+// New starts following a page that is to change from baseline. A nil
+// baseline counts as changed from the first sample.
+func New(baseline *image.RGBA, settings Settings) *Detector {
+	return &Detector{settings: settings, baseline: baseline, changed: baseline == nil}
+}
+
+// Add takes the next sample and reports whether the page has changed from
+// the baseline, and whether it has since settled.
+func (d *Detector) Add(img *image.RGBA, now time.Time) (changed, settled bool) {
+	if !d.changed {
+		d.changed = !d.similar(d.baseline, img)
+	} else if d.previous != nil {
+		if d.similar(d.previous, img) {
+			d.stable++
+		} else {
+			d.stable = 0
+		}
+	}
+	d.previous = img
+
+	// A page that moves again before the gap has passed has to settle again
+	settled = d.changed && d.stable >= d.settings.Frames && now.Sub(d.rebased) >= d.settings.MinGap
+	return d.changed, settled
+}
+
+// Reset forgets the samples taken so far, after a pause in sampling. The
+// baseline and whether the page has changed from it are kept.
+func (d *Detector) Reset() {
+	d.previous, d.stable = nil, 0
+}
+
+// Rebase makes img, the page captured at now, the baseline the next page
+// has to change from.
+func (d *Detector) Rebase(img *image.RGBA, now time.Time) {
+	d.baseline, d.previous = img, nil
+	d.changed, d.stable = false, 0
+	d.rebased = now
+}
+
+func (d *Detector) similar(a, b *image.RGBA) bool {
+	return similarity.Diff(a, b) < d.settings.Threshold
+}
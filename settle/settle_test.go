@@ -0,0 +1,109 @@
+package settle
+
+import (
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+// shade returns a uniform frame; frames of different shades differ in every
+// pixel.
+func shade(v uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			img.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+// step is one sample and what Add should report for it.
+type step struct {
+	img              *image.RGBA
+	at               time.Duration // since the start
+	changed, settled bool
+}
+
+func follow(t *testing.T, name string, d *Detector, start time.Time, steps []step) {
+	t.Helper()
+	for i, s := range steps {
+		changed, settled := d.Add(s.img, start.Add(s.at))
+		if changed != s.changed || settled != s.settled {
+			t.Errorf("%s: sample %d: Add() = %v, %v, want %v, %v", name, i, changed, settled, s.changed, s.settled)
+		}
+	}
+}
+
+func TestDetector(t *testing.T) {
+	old, moving, turned := shade(0), shade(120), shade(255)
+	settings := Settings{Threshold: 0.01, Frames: 2}
+	start := time.Now()
+
+	follow(t, "turn", New(old, settings), start, []step{
+		{old, 0, false, false},
+		{old, 1, false, false},
+		{moving, 2, true, false},
+		{turned, 3, true, false},
+		{turned, 4, true, false},
+		{turned, 5, true, true},
+		{turned, 6, true, true},
+	})
+
+	follow(t, "no baseline", New(nil, settings), start, []step{
+		{turned, 0, true, false},
+		{turned, 1, true, false},
+		{turned, 2, true, true},
+	})
+
+	// Moving again restarts the count
+	follow(t, "moving", New(old, settings), start, []step{
+		{turned, 0, true, false},
+		{turned, 1, true, false},
+		{moving, 2, true, false},
+		{moving, 3, true, false},
+		{moving, 4, true, true},
+	})
+}
+
+func TestMinGap(t *testing.T) {
+	old, turned, next := shade(0), shade(255), shade(120)
+	d := New(old, Settings{Threshold: 0.01, Frames: 1, MinGap: time.Second})
+	start := time.Now()
+
+	follow(t, "first page", d, start, []step{
+		{turned, 0, true, false},
+		{turned, 100 * time.Millisecond, true, true},
+	})
+	d.Rebase(turned, start.Add(100*time.Millisecond))
+
+	// The next page settles within the gap, and is held until it passes
+	follow(t, "next page", d, start, []step{
+		{turned, 200 * time.Millisecond, false, false},
+		{next, 300 * time.Millisecond, true, false},
+		{next, 400 * time.Millisecond, true, false},
+		{next, 1099 * time.Millisecond, true, false},
+		{next, 1100 * time.Millisecond, true, true},
+	})
+}
+
+func TestReset(t *testing.T) {
+	old, turned := shade(0), shade(255)
+	d := New(old, Settings{Threshold: 0.01, Frames: 2})
+	start := time.Now()
+
+	follow(t, "before pause", d, start, []step{
+		{turned, 0, true, false},
+		{turned, 1, true, false},
+	})
+
+	// After a pause the page has to hold still for the full count again,
+	// but still counts as changed from the baseline
+	d.Reset()
+	follow(t, "after pause", d, start, []step{
+		{turned, 2, true, false},
+		{turned, 3, true, false},
+		{turned, 4, true, true},
+	})
+}
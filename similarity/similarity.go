@@ -0,0 +1,60 @@
+// Package similarity holds the pixel-difference metric the capture tool uses
+// to decide whether two captures show the same page.
+package similarity
+
+import "image"
+
+const (
+	// SampleRate compares every SampleRate-th pixel in both directions,
+	// which is plenty for text pages and far faster than a full comparison
+	SampleRate = 10
+	// PixelDistance is the RGB distance (0-441) above which a sampled pixel
+	// counts as different
+	PixelDistance = 30
+)
+
+// Samples are the pixels of a capture the metric looks at. Keeping only
+// these lets many captures be compared without holding them in memory.
+type Samples struct {
+	bounds image.Rectangle
+	rgb    []uint8
+}
+
+// Sample extracts the compared pixels of img.
+func Sample(img *image.RGBA) Samples {
+	bounds := img.Bounds()
+	s := Samples{bounds: bounds}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += SampleRate {
+		for x := bounds.Min.X; x < bounds.Max.X; x += SampleRate {
+			c := img.RGBAAt(x, y)
+			s.rgb = append(s.rgb, c.R, c.G, c.B)
+		}
+	}
+	return s
+}
+
+// Diff returns the ratio of sampled pixels that differ between s and t:
+// 0 for identical captures, 1 for completely different ones or captures of
+// different sizes.
+func (s Samples) Diff(t Samples) float64 {
+	if s.bounds.Size() != t.bounds.Size() || len(s.rgb) == 0 {
+		return 1
+	}
+
+	different := 0
+	for i := 0; i < len(s.rgb); i += 3 {
+		// Euclidean distance in RGB space
+		dr := int(s.rgb[i]) - int(t.rgb[i])
+		dg := int(s.rgb[i+1]) - int(t.rgb[i+1])
+		db := int(s.rgb[i+2]) - int(t.rgb[i+2])
+		if dr*dr+dg*dg+db*db > PixelDistance*PixelDistance {
+			different++
+		}
+	}
+	return float64(different) / float64(len(s.rgb)/3)
+}
+
+// Diff compares two captures.
+func Diff(a, b *image.RGBA) float64 {
+	return Sample(a).Diff(Sample(b))
+}
@@ -0,0 +1,58 @@
+package similarity
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func fill(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestDiff(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	base := fill(100, 100, white)
+
+	// Recolour the top rows: 100x100 has 10x10 samples, so every sampled
+	// row is 10% of them
+	rows := func(n int, c color.RGBA) *image.RGBA {
+		img := fill(100, 100, white)
+		for y := 0; y < n*SampleRate; y++ {
+			for x := 0; x < 100; x++ {
+				img.SetRGBA(x, y, c)
+			}
+		}
+		return img
+	}
+
+	tests := []struct {
+		name string
+		b    *image.RGBA
+		want float64
+	}{
+		{"identical", fill(100, 100, white), 0},
+		{"three rows black", rows(3, color.RGBA{0, 0, 0, 255}), 0.3},
+		{"all black", rows(10, color.RGBA{0, 0, 0, 255}), 1},
+		{"slight tint", rows(10, color.RGBA{240, 245, 250, 255}), 0},
+		{"different size", fill(100, 90, white), 1},
+	}
+	for _, tt := range tests {
+		if got := Diff(base, tt.b); got != tt.want {
+			t.Errorf("%s: Diff = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Only sampled pixels count
+	unsampled := fill(100, 100, white)
+	unsampled.SetRGBA(5, 5, color.RGBA{0, 0, 0, 255})
+	if got := Diff(base, unsampled); got != 0 {
+		t.Errorf("change between samples: Diff = %v, want 0", got)
+	}
+}
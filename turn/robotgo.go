@@ -0,0 +1,31 @@
+//go:build cgo
+
+package turn
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// Key presses a key through robotgo.
+type Key struct {
+	Key string // robotgo key name, e.g. "right" or "pagedown"
+}
+
+func (k Key) Turn() error  { return robotgo.KeyTap(k.Key) }
+func (k Key) Name() string { return "key " + k.Key }
+
+// Click clicks the left mouse button at a screen position through robotgo,
+// for readers that turn pages on a click in the page margin.
+type Click struct {
+	At image.Point
+}
+
+func (c Click) Turn() error {
+	robotgo.MoveClick(c.At.X, c.At.Y, "left")
+	return nil
+}
+
+func (c Click) Name() string { return fmt.Sprintf("click at (%d,%d)", c.At.X, c.At.Y) }
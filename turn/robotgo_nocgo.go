@@ -0,0 +1,31 @@
+//go:build !cgo
+
+package turn
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// Key presses a key through robotgo, which needs cgo.
+type Key struct {
+	Key string
+}
+
+func (k Key) Turn() error {
+	return fmt.Errorf("robotgo key presses: %w without cgo", errors.ErrUnsupported)
+}
+
+func (k Key) Name() string { return "key " + k.Key }
+
+// Click clicks through robotgo, which needs cgo.
+type Click struct {
+	At image.Point
+}
+
+func (c Click) Turn() error {
+	return fmt.Errorf("robotgo clicks: %w without cgo", errors.ErrUnsupported)
+}
+
+func (c Click) Name() string { return fmt.Sprintf("click at (%d,%d)", c.At.X, c.At.Y) }
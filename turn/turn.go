@@ -0,0 +1,123 @@
+// Package turn advances the reader app to the next page. Apps differ on
+// whether arrow keys, PageDown or clicks turn pages, and platforms on how
+// input can be injected, so each way is a PageTurner.
+package turn
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"screenshot-capture/keysym"
+	"screenshot-capture/vnc"
+)
+
+// PageTurner turns one page.
+type PageTurner interface {
+	Turn() error
+	// Name describes the page turn in log messages, e.g. "key right".
+	Name() string
+}
+
+// Parse builds the page turner for a -turn spec: key, xtest, command,
+// click:X,Y or none. Keys and clicks go to client when it is not nil; key
+// names the key to press and command the shell command to run.
+func Parse(spec, key, command string, client *vnc.Client) (PageTurner, error) {
+	if at, ok := strings.CutPrefix(spec, "click:"); ok {
+		var p image.Point
+		if _, err := fmt.Sscanf(at, "%d,%d", &p.X, &p.Y); err != nil {
+			return nil, fmt.Errorf("invalid click position %q, want X,Y", at)
+		}
+		if client != nil {
+			return VNCClick{Client: client, At: p}, nil
+		}
+		return Click{At: p}, nil
+	}
+
+	switch spec {
+	case "key":
+		if client != nil {
+			return VNCKey{Client: client, Key: key}, nil
+		}
+		return Key{Key: key}, nil
+	case "xtest":
+		if _, err := keysym.Lookup(key); err != nil {
+			return nil, err
+		}
+		return &XTest{Key: key}, nil
+	case "command":
+		if command == "" {
+			return nil, errors.New("-turn command needs -turn-cmd")
+		}
+		return Command{Line: command}, nil
+	case "none":
+		return &Recorder{}, nil
+	}
+	return nil, fmt.Errorf("unknown page turner %q", spec)
+}
+
+// Command runs a shell command such as "xdotool key Right", "ydotool key
+// 106:1 106:0" or "adb shell input keyevent 22".
+type Command struct {
+	Line string
+}
+
+func (c Command) Turn() error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", c.Line)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("page turn command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (c Command) Name() string { return fmt.Sprintf("command %q", c.Line) }
+
+// VNCKey presses a key on a VNC desktop.
+type VNCKey struct {
+	Client *vnc.Client
+	Key    string
+}
+
+func (k VNCKey) Turn() error  { return k.Client.KeyTap(k.Key) }
+func (k VNCKey) Name() string { return "VNC key " + k.Key }
+
+// VNCClick clicks at a position on a VNC desktop.
+type VNCClick struct {
+	Client *vnc.Client
+	At     image.Point
+}
+
+func (c VNCClick) Turn() error  { return c.Client.Click(c.At) }
+func (c VNCClick) Name() string { return fmt.Sprintf("VNC click at (%d,%d)", c.At.X, c.At.Y) }
+
+// Recorder turns nothing and counts the calls, for tests and for capturing
+// sources that page by themselves.
+type Recorder struct {
+	mu    sync.Mutex
+	turns int
+	Err   error // Returned by every Turn, to simulate failures
+}
+
+func (r *Recorder) Turn() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.turns++
+	return r.Err
+}
+
+func (r *Recorder) Name() string { return "no-op" }
+
+// Turns returns how often Turn was called.
+func (r *Recorder) Turns() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.turns
+}
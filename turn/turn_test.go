@@ -0,0 +1,102 @@
+package turn
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"screenshot-capture/vnc"
+)
+
+func TestCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "turned")
+	c := Command{Line: "echo turned > " + out}
+	if err := c.Turn(); err != nil {
+		t.Fatalf("Turn() = %v", err)
+	}
+	if data, err := os.ReadFile(out); err != nil || strings.TrimSpace(string(data)) != "turned" {
+		t.Errorf("Turn() did not run %q: %q, %v", c.Line, data, err)
+	}
+
+	failing := Command{Line: "echo no device >&2; exit 3"}
+	err := failing.Turn()
+	if err == nil {
+		t.Fatalf("Turn() of a failing command succeeded")
+	}
+	for _, want := range []string{"exit status 3", "no device"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Turn() = %q, want it to mention %q", err, want)
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	r := &Recorder{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.Turn(); err != nil {
+				t.Errorf("Turn() = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if r.Turns() != 10 {
+		t.Errorf("Turns() = %d, want 10", r.Turns())
+	}
+
+	r.Err = errors.New("stuck")
+	if err := r.Turn(); err != r.Err {
+		t.Errorf("Turn() = %v, want %v", err, r.Err)
+	}
+	if r.Turns() != 11 {
+		t.Errorf("Turns() = %d, want failed turns counted too", r.Turns())
+	}
+}
+
+func TestParse(t *testing.T) {
+	client := &vnc.Client{}
+	tests := []struct {
+		spec, key, command string
+		client             *vnc.Client
+		want               string // type and name of the page turner
+	}{
+		{"key", "right", "", nil, `turn.Key key right`},
+		{"key", "pagedown", "", client, `turn.VNCKey VNC key pagedown`},
+		{"xtest", "right", "", nil, `*turn.XTest XTEST key right`},
+		{"command", "", "xdotool key Right", nil, `turn.Command command "xdotool key Right"`},
+		{"click:100,200", "", "", nil, `turn.Click click at (100,200)`},
+		{"click:5,6", "", "", client, `turn.VNCClick VNC click at (5,6)`},
+		{"none", "right", "", nil, `*turn.Recorder no-op`},
+	}
+	for _, tt := range tests {
+		pt, err := Parse(tt.spec, tt.key, tt.command, tt.client)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T %s", pt, pt.Name()); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.spec, got, tt.want)
+		}
+	}
+
+	bad := []struct{ spec, key, command string }{
+		{"click:100", "", ""},
+		{"click:x,y", "", ""},
+		{"xtest", "nosuchkey", ""},
+		{"command", "", ""},
+		{"mouse", "right", ""},
+		{"", "right", ""},
+	}
+	for _, tt := range bad {
+		if _, err := Parse(tt.spec, tt.key, tt.command, nil); err == nil {
+			t.Errorf("Parse(%q, %q, %q) succeeded, want error", tt.spec, tt.key, tt.command)
+		}
+	}
+}
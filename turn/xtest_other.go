@@ -0,0 +1,20 @@
+//go:build !(linux || freebsd || netbsd || openbsd)
+
+package turn
+
+import (
+	"errors"
+	"fmt"
+)
+
+// XTest presses a key through the X11 XTEST extension, which this platform
+// doesn't have.
+type XTest struct {
+	Key string
+}
+
+func (t *XTest) Name() string { return "XTEST key " + t.Key }
+
+func (t *XTest) Turn() error {
+	return fmt.Errorf("XTEST page turns: %w", errors.ErrUnsupported)
+}
@@ -0,0 +1,81 @@
+//go:build linux || freebsd || netbsd || openbsd
+
+package turn
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+	"github.com/jezek/xgb/xtest"
+
+	"screenshot-capture/keysym"
+)
+
+// XTest presses a key through the X11 XTEST extension. It needs no cgo,
+// unlike robotgo, and works on any X server, including Xvfb and Xwayland.
+type XTest struct {
+	Key string
+
+	mu      sync.Mutex
+	conn    *xgb.Conn
+	root    xproto.Window
+	keycode xproto.Keycode
+}
+
+func (t *XTest) Name() string { return "XTEST key " + t.Key }
+
+func (t *XTest) Turn() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		if err := t.connect(); err != nil {
+			return err
+		}
+	}
+
+	for _, event := range []byte{xproto.KeyPress, xproto.KeyRelease} {
+		if err := xtest.FakeInputChecked(t.conn, event, byte(t.keycode), 0, t.root, 0, 0, 0).Check(); err != nil {
+			return fmt.Errorf("XTEST key event failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// connect opens the display and finds the keycode that produces Key.
+func (t *XTest) connect() error {
+	sym, err := keysym.Lookup(t.Key)
+	if err != nil {
+		return err
+	}
+
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to X server: %w", err)
+	}
+	if err := xtest.Init(conn); err != nil {
+		conn.Close()
+		return fmt.Errorf("X server lacks the XTEST extension: %w", err)
+	}
+
+	setup := xproto.Setup(conn)
+	count := int(setup.MaxKeycode-setup.MinKeycode) + 1
+	mapping, err := xproto.GetKeyboardMapping(conn, setup.MinKeycode, byte(count)).Reply()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to read keyboard mapping: %w", err)
+	}
+
+	per := int(mapping.KeysymsPerKeycode)
+	for i, s := range mapping.Keysyms {
+		if uint32(s) == sym {
+			t.conn, t.root = conn, setup.DefaultScreen(conn).Root
+			t.keycode = setup.MinKeycode + xproto.Keycode(i/per)
+			return nil
+		}
+	}
+	conn.Close()
+	return fmt.Errorf("no key produces %q in the current keyboard layout", t.Key)
+}
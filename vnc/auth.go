@@ -0,0 +1,30 @@
+package vnc
+
+import (
+	"crypto/des"
+	"math/bits"
+)
+
+// encryptChallenge answers a VNC authentication challenge: the 16 bytes are
+// DES-encrypted with the password as the key. The password is cut or
+// zero-padded to 8 bytes and, for historical reasons, every key byte has its
+// bits mirrored.
+func encryptChallenge(challenge []byte, password string) ([]byte, error) {
+	var key [8]byte
+	copy(key[:], password)
+	for i, b := range key {
+		key[i] = bits.Reverse8(b)
+	}
+
+	cipher, err := des.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	// ECB: each 8-byte block on its own
+	response := make([]byte, len(challenge))
+	for i := 0; i+des.BlockSize <= len(challenge); i += des.BlockSize {
+		cipher.Encrypt(response[i:], challenge[i:i+des.BlockSize])
+	}
+	return response, nil
+}
@@ -0,0 +1,459 @@
+// Package vnc is a minimal RFB (VNC) client: enough to capture the
+// framebuffer of a reader app running in a VM or container and to turn its
+// pages with key events. It speaks protocol versions 3.3 to 3.8 with no or
+// VNC password authentication, and the Raw and CopyRect encodings.
+package vnc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"screenshot-capture/capture"
+	"screenshot-capture/keysym"
+)
+
+// Security types
+const (
+	securityNone    = 1
+	securityVNCAuth = 2
+)
+
+// Encodings
+const (
+	encodingRaw      = 0
+	encodingCopyRect = 1
+)
+
+// Client to server message types
+const (
+	msgSetPixelFormat           = 0
+	msgSetEncodings             = 2
+	msgFramebufferUpdateRequest = 3
+	msgKeyEvent                 = 4
+	msgPointerEvent             = 5
+)
+
+// Server to client message types
+const (
+	msgFramebufferUpdate   = 0
+	msgSetColourMapEntries = 1
+	msgBell                = 2
+	msgServerCutText       = 3
+)
+
+// Client is a connection to an RFB server. It is a capture.Capturer.
+type Client struct {
+	// Timeout bounds every capture and input event, so a stalled server
+	// fails them instead of hanging; 0 waits forever
+	Timeout time.Duration
+
+	conn net.Conn
+	r    *bufio.Reader
+
+	writeMu sync.Mutex // Key events may be sent while a capture is read
+
+	captureMu sync.Mutex
+	fb        *image.RGBA // Framebuffer, updated by every capture
+	desktop   string      // Desktop name announced by the server
+	broken    error       // Set once a read fails part way through a message
+}
+
+// Dial connects to an RFB server at addr ("host:port"), authenticating with
+// password if the server asks for it.
+func Dial(addr, password string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to VNC server: %w", err)
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	c, err := NewClient(conn, password)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	c.Timeout = timeout
+	return c, nil
+}
+
+// NewClient runs the RFB handshake over an established connection.
+func NewClient(conn net.Conn, password string) (*Client, error) {
+	c := &Client{conn: conn, r: bufio.NewReader(conn)}
+
+	minor, err := c.negotiateVersion()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.authenticate(minor, password); err != nil {
+		return nil, err
+	}
+	if err := c.initialise(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// negotiateVersion answers the server's ProtocolVersion with the highest
+// version both sides speak, and returns its minor number.
+func (c *Client) negotiateVersion() (int, error) {
+	var greeting [12]byte
+	if _, err := io.ReadFull(c.r, greeting[:]); err != nil {
+		return 0, fmt.Errorf("failed to read RFB version: %w", err)
+	}
+
+	var major, minor int
+	if _, err := fmt.Sscanf(string(greeting[:]), "RFB %03d.%03d\n", &major, &minor); err != nil || major != 3 {
+		return 0, fmt.Errorf("unsupported RFB server version %q", greeting[:11])
+	}
+
+	// 3.3, 3.7 and 3.8 are the published versions; anything newer speaks 3.8
+	switch {
+	case minor >= 8:
+		minor = 8
+	case minor == 7:
+	default:
+		minor = 3
+	}
+	if _, err := fmt.Fprintf(c.conn, "RFB 003.%03d\n", minor); err != nil {
+		return 0, err
+	}
+	return minor, nil
+}
+
+func (c *Client) authenticate(minor int, password string) error {
+	var security uint8
+
+	if minor == 3 {
+		// The server decides
+		var t uint32
+		if err := binary.Read(c.r, binary.BigEndian, &t); err != nil {
+			return fmt.Errorf("failed to read security type: %w", err)
+		}
+		if t == 0 {
+			return fmt.Errorf("VNC server refused the connection: %s", c.readReason())
+		}
+		security = uint8(t)
+	} else {
+		// The server offers, the client picks
+		n, err := c.r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("failed to read security types: %w", err)
+		}
+		if n == 0 {
+			return fmt.Errorf("VNC server refused the connection: %s", c.readReason())
+		}
+		offered := make([]byte, n)
+		if _, err := io.ReadFull(c.r, offered); err != nil {
+			return fmt.Errorf("failed to read security types: %w", err)
+		}
+		for _, t := range offered {
+			// Prefer no authentication, then the password
+			if t == securityNone || (t == securityVNCAuth && security != securityNone) {
+				security = t
+			}
+		}
+		if security == 0 {
+			return fmt.Errorf("VNC server offers no supported security type (offered %v)", offered)
+		}
+		if _, err := c.conn.Write([]byte{security}); err != nil {
+			return err
+		}
+	}
+
+	switch security {
+	case securityNone:
+		// Only 3.8 confirms the absence of authentication
+		if minor < 8 {
+			return nil
+		}
+	case securityVNCAuth:
+		var challenge [16]byte
+		if _, err := io.ReadFull(c.r, challenge[:]); err != nil {
+			return fmt.Errorf("failed to read VNC auth challenge: %w", err)
+		}
+		response, err := encryptChallenge(challenge[:], password)
+		if err != nil {
+			return err
+		}
+		if _, err := c.conn.Write(response); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported VNC security type %d", security)
+	}
+
+	var result uint32
+	if err := binary.Read(c.r, binary.BigEndian, &result); err != nil {
+		return fmt.Errorf("failed to read security result: %w", err)
+	}
+	if result != 0 {
+		reason := "wrong password?"
+		if minor == 8 {
+			reason = c.readReason()
+		}
+		return fmt.Errorf("VNC authentication failed: %s", reason)
+	}
+	return nil
+}
+
+// readReason reads a length-prefixed failure message.
+func (c *Client) readReason() string {
+	var n uint32
+	if err := binary.Read(c.r, binary.BigEndian, &n); err != nil || n > 1<<16 {
+		return "no reason given"
+	}
+	reason := make([]byte, n)
+	if _, err := io.ReadFull(c.r, reason); err != nil {
+		return "no reason given"
+	}
+	return string(reason)
+}
+
+// initialise shares the desktop, reads its size and asks for pixels in
+// *image.RGBA layout.
+func (c *Client) initialise() error {
+	if _, err := c.conn.Write([]byte{1}); err != nil { // Shared session
+		return err
+	}
+
+	var init struct {
+		Width, Height uint16
+		PixelFormat   [16]byte
+		NameLength    uint32
+	}
+	if err := binary.Read(c.r, binary.BigEndian, &init); err != nil {
+		return fmt.Errorf("failed to read server init: %w", err)
+	}
+	if init.NameLength > 1<<16 {
+		return fmt.Errorf("invalid desktop name length %d", init.NameLength)
+	}
+	name := make([]byte, init.NameLength)
+	if _, err := io.ReadFull(c.r, name); err != nil {
+		return fmt.Errorf("failed to read desktop name: %w", err)
+	}
+	c.desktop = string(name)
+	c.fb = image.NewRGBA(image.Rect(0, 0, int(init.Width), int(init.Height)))
+
+	// 32 bits per pixel, little-endian true colour with red in the lowest
+	// byte: exactly the R, G, B, A byte order of image.RGBA
+	pixelFormat := []byte{
+		msgSetPixelFormat, 0, 0, 0,
+		32, 24, 0, 1, // bpp, depth, big-endian, true colour
+		0, 255, 0, 255, 0, 255, // Red, green and blue max
+		0, 8, 16, // Shifts
+		0, 0, 0,
+	}
+	encodings := []byte{msgSetEncodings, 0, 0, 2}
+	encodings = binary.BigEndian.AppendUint32(encodings, encodingCopyRect)
+	encodings = binary.BigEndian.AppendUint32(encodings, encodingRaw)
+
+	return c.write(append(pixelFormat, encodings...))
+}
+
+func (c *Client) write(msg []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.Timeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.Timeout))
+	}
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+// Name identifies the backend.
+func (c *Client) Name() string { return "vnc" }
+
+// Desktop returns the desktop name and size announced by the server.
+func (c *Client) Desktop() (string, image.Rectangle) { return c.desktop, c.fb.Bounds() }
+
+// Capture requests the whole framebuffer and returns a copy of it once the
+// update has arrived. Full rather than incremental updates are requested,
+// as servers hold incremental ones back until something changes.
+func (c *Client) Capture() (capture.Frame, error) {
+	c.captureMu.Lock()
+	defer c.captureMu.Unlock()
+
+	// After a failed read the next byte may be anywhere in a message
+	if c.broken != nil {
+		return capture.Frame{}, fmt.Errorf("VNC connection unusable after an earlier error: %w", c.broken)
+	}
+	if c.Timeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.Timeout))
+	}
+
+	frame, err := c.readFrame()
+	if err != nil {
+		c.broken = err
+	}
+	return frame, err
+}
+
+// readFrame requests an update and reads messages until it has arrived.
+func (c *Client) readFrame() (capture.Frame, error) {
+	b := c.fb.Bounds()
+	req := []byte{msgFramebufferUpdateRequest, 0}
+	for _, v := range []int{b.Min.X, b.Min.Y, b.Dx(), b.Dy()} {
+		req = binary.BigEndian.AppendUint16(req, uint16(v))
+	}
+	if err := c.write(req); err != nil {
+		return capture.Frame{}, fmt.Errorf("failed to request VNC update: %w", err)
+	}
+
+	for {
+		msgType, err := c.r.ReadByte()
+		if err != nil {
+			return capture.Frame{}, fmt.Errorf("failed to read VNC message: %w", err)
+		}
+
+		switch msgType {
+		case msgFramebufferUpdate:
+			if err := c.readUpdate(); err != nil {
+				return capture.Frame{}, err
+			}
+			img := image.NewRGBA(b)
+			copy(img.Pix, c.fb.Pix)
+			return capture.Frame{Image: img, Window: true, Bounds: b, Scale: 1}, nil
+		case msgSetColourMapEntries:
+			// Unused with true colour, but must be consumed
+			var hdr struct {
+				Pad          uint8
+				First, Count uint16
+			}
+			if err := binary.Read(c.r, binary.BigEndian, &hdr); err != nil {
+				return capture.Frame{}, err
+			}
+			if _, err := c.r.Discard(int(hdr.Count) * 6); err != nil {
+				return capture.Frame{}, err
+			}
+		case msgBell:
+		case msgServerCutText:
+			var hdr struct {
+				Pad    [3]uint8
+				Length uint32
+			}
+			if err := binary.Read(c.r, binary.BigEndian, &hdr); err != nil {
+				return capture.Frame{}, err
+			}
+			if _, err := c.r.Discard(int(hdr.Length)); err != nil {
+				return capture.Frame{}, err
+			}
+		default:
+			return capture.Frame{}, fmt.Errorf("unexpected VNC message type %d", msgType)
+		}
+	}
+}
+
+// readUpdate applies the rectangles of a FramebufferUpdate to the
+// framebuffer.
+func (c *Client) readUpdate() error {
+	var hdr struct {
+		Pad   uint8
+		Count uint16
+	}
+	if err := binary.Read(c.r, binary.BigEndian, &hdr); err != nil {
+		return fmt.Errorf("failed to read VNC update: %w", err)
+	}
+
+	for i := 0; i < int(hdr.Count); i++ {
+		var rect struct {
+			X, Y, Width, Height uint16
+			Encoding            int32
+		}
+		if err := binary.Read(c.r, binary.BigEndian, &rect); err != nil {
+			return fmt.Errorf("failed to read VNC rectangle: %w", err)
+		}
+		r := image.Rect(int(rect.X), int(rect.Y), int(rect.X)+int(rect.Width), int(rect.Y)+int(rect.Height))
+		if !r.In(c.fb.Bounds()) {
+			return fmt.Errorf("VNC rectangle %v outside the %v framebuffer", r, c.fb.Bounds())
+		}
+
+		switch rect.Encoding {
+		case encodingRaw:
+			// Rows of 4-byte pixels, already in RGBA order; the padding
+			// byte becomes an opaque alpha
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				row := c.fb.Pix[c.fb.PixOffset(r.Min.X, y):c.fb.PixOffset(r.Max.X, y)]
+				if _, err := io.ReadFull(c.r, row); err != nil {
+					return fmt.Errorf("failed to read VNC pixels: %w", err)
+				}
+				for x := 3; x < len(row); x += 4 {
+					row[x] = 255
+				}
+			}
+		case encodingCopyRect:
+			var src struct{ X, Y uint16 }
+			if err := binary.Read(c.r, binary.BigEndian, &src); err != nil {
+				return fmt.Errorf("failed to read VNC copy: %w", err)
+			}
+			from := image.Rect(int(src.X), int(src.Y), int(src.X)+r.Dx(), int(src.Y)+r.Dy())
+			if !from.In(c.fb.Bounds()) {
+				return fmt.Errorf("VNC copy source %v outside the framebuffer", from)
+			}
+			copyRect(c.fb, r, from.Min)
+		default:
+			return fmt.Errorf("VNC server sent unrequested encoding %d", rect.Encoding)
+		}
+	}
+	return nil
+}
+
+// copyRect copies the pixels at from to dst within fb, handling overlap.
+func copyRect(fb *image.RGBA, dst image.Rectangle, from image.Point) {
+	rowLen := dst.Dx() * 4
+	rows := make([][]byte, dst.Dy())
+	for i := range rows {
+		off := fb.PixOffset(from.X, from.Y+i)
+		rows[i] = append([]byte(nil), fb.Pix[off:off+rowLen]...)
+	}
+	for i, row := range rows {
+		copy(fb.Pix[fb.PixOffset(dst.Min.X, dst.Min.Y+i):], row)
+	}
+}
+
+// KeyTap presses and releases a key, named as for robotgo ("right",
+// "pagedown", "n").
+func (c *Client) KeyTap(key string) error {
+	sym, err := keysym.Lookup(key)
+	if err != nil {
+		return err
+	}
+	for _, down := range []byte{1, 0} {
+		msg := binary.BigEndian.AppendUint32([]byte{msgKeyEvent, down, 0, 0}, sym)
+		if err := c.write(msg); err != nil {
+			return fmt.Errorf("failed to send VNC key event: %w", err)
+		}
+	}
+	return nil
+}
+
+// Click presses and releases the left mouse button at p.
+func (c *Client) Click(p image.Point) error {
+	if !p.In(c.fb.Bounds()) {
+		return errors.New("click outside the VNC desktop")
+	}
+	for _, buttons := range []byte{1, 0} {
+		msg := []byte{msgPointerEvent, buttons}
+		msg = binary.BigEndian.AppendUint16(msg, uint16(p.X))
+		msg = binary.BigEndian.AppendUint16(msg, uint16(p.Y))
+		if err := c.write(msg); err != nil {
+			return fmt.Errorf("failed to send VNC pointer event: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close disconnects from the server.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
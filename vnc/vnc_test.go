@@ -0,0 +1,288 @@
+package vnc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer is the server end of an in-process RFB connection.
+type fakeServer struct {
+	version  string // e.g. "003.008"
+	security uint8
+	password string
+	width    int
+	height   int
+}
+
+// handshake runs the server side of the handshake over conn.
+func (s fakeServer) handshake(conn net.Conn) error {
+	fmt.Fprintf(conn, "RFB %s\n", s.version)
+	var reply [12]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+
+	if s.version == "003.003" {
+		binary.Write(conn, binary.BigEndian, uint32(s.security))
+	} else {
+		conn.Write([]byte{1, s.security})
+		var choice [1]byte
+		if _, err := io.ReadFull(conn, choice[:]); err != nil {
+			return err
+		}
+		if choice[0] != s.security {
+			return fmt.Errorf("client chose security type %d", choice[0])
+		}
+	}
+
+	if s.security == securityVNCAuth {
+		challenge := []byte("0123456789abcdef")
+		conn.Write(challenge)
+		var response [16]byte
+		if _, err := io.ReadFull(conn, response[:]); err != nil {
+			return err
+		}
+		want, _ := encryptChallenge(challenge, s.password)
+		if !bytes.Equal(response[:], want) {
+			reason := "bad password"
+			binary.Write(conn, binary.BigEndian, uint32(1))
+			binary.Write(conn, binary.BigEndian, uint32(len(reason)))
+			conn.Write([]byte(reason))
+			return errors.New(reason)
+		}
+	}
+	if s.security == securityVNCAuth || s.version >= "003.008" {
+		binary.Write(conn, binary.BigEndian, uint32(0))
+	}
+
+	var shared [1]byte
+	if _, err := io.ReadFull(conn, shared[:]); err != nil {
+		return err
+	}
+	name := "reader"
+	init := binary.BigEndian.AppendUint16(nil, uint16(s.width))
+	init = binary.BigEndian.AppendUint16(init, uint16(s.height))
+	init = append(init, make([]byte, 16)...)
+	init = binary.BigEndian.AppendUint32(init, uint32(len(name)))
+	conn.Write(append(init, name...))
+
+	// SetPixelFormat and SetEncodings with two encodings
+	var formats [20 + 4 + 8]byte
+	_, err := io.ReadFull(conn, formats[:])
+	return err
+}
+
+// update writes a FramebufferUpdate filling the whole screen with one
+// colour, preceded by a bell to be skipped.
+func (s fakeServer) update(conn net.Conn, red uint8) {
+	msg := []byte{msgBell, msgFramebufferUpdate, 0, 0, 1}
+	for _, v := range []int{0, 0, s.width, s.height} {
+		msg = binary.BigEndian.AppendUint16(msg, uint16(v))
+	}
+	msg = binary.BigEndian.AppendUint32(msg, encodingRaw)
+	for i := 0; i < s.width*s.height; i++ {
+		msg = append(msg, red, 2, 3, 0)
+	}
+	conn.Write(msg)
+}
+
+func connect(t *testing.T, s fakeServer, password string) (*Client, net.Conn, error) {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close(); server.Close() })
+
+	done := make(chan error, 1)
+	go func() { done <- s.handshake(server) }()
+
+	c, err := NewClient(client, password)
+	if err != nil {
+		client.Close()
+		<-done
+		return nil, nil, err
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+	return c, server, nil
+}
+
+func TestHandshake(t *testing.T) {
+	tests := []struct {
+		server   fakeServer
+		password string
+		wantErr  string
+	}{
+		{fakeServer{version: "003.003", security: securityNone}, "", ""},
+		{fakeServer{version: "003.007", security: securityNone}, "", ""},
+		{fakeServer{version: "003.008", security: securityNone}, "", ""},
+		{fakeServer{version: "003.889", security: securityNone}, "", ""},
+		{fakeServer{version: "003.003", security: securityVNCAuth, password: "secret"}, "secret", ""},
+		{fakeServer{version: "003.008", security: securityVNCAuth, password: "secret"}, "secret", ""},
+		{fakeServer{version: "003.008", security: securityVNCAuth, password: "secret"}, "wrong", "bad password"},
+		{fakeServer{version: "004.000", security: securityNone}, "", "unsupported RFB server version"},
+	}
+	for _, tt := range tests {
+		tt.server.width, tt.server.height = 4, 3
+		c, _, err := connect(t, tt.server, tt.password)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("RFB %s with security %d: NewClient = %v, want error containing %q", tt.server.version, tt.server.security, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("RFB %s with security %d: NewClient = %v", tt.server.version, tt.server.security, err)
+			continue
+		}
+		if name, bounds := c.Desktop(); name != "reader" || bounds != image.Rect(0, 0, 4, 3) {
+			t.Errorf("RFB %s: Desktop() = %q, %v", tt.server.version, name, bounds)
+		}
+	}
+}
+
+func TestCapture(t *testing.T) {
+	s := fakeServer{version: "003.008", security: securityNone, width: 4, height: 3}
+	c, server, err := connect(t, s, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Timeout = 2 * time.Second
+
+	for _, red := range []uint8{10, 20} {
+		go func() {
+			var req [10]byte
+			if _, err := io.ReadFull(server, req[:]); err == nil && req[0] == msgFramebufferUpdateRequest {
+				s.update(server, red)
+			}
+		}()
+		frame, err := c.Capture()
+		if err != nil {
+			t.Fatalf("Capture() = %v", err)
+		}
+		img := frame.Image
+		if got := img.Pix[len(img.Pix)-4:]; !bytes.Equal(got, []byte{red, 2, 3, 255}) {
+			t.Errorf("Capture() last pixel = %v, want %v", got, []byte{red, 2, 3, 255})
+		}
+	}
+}
+
+func TestCaptureTimeout(t *testing.T) {
+	s := fakeServer{version: "003.008", security: securityNone, width: 4, height: 3}
+	c, server, err := connect(t, s, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Timeout = 200 * time.Millisecond
+
+	// Read the request, then send half an update and stall
+	go func() {
+		var req [10]byte
+		io.ReadFull(server, req[:])
+		server.Write([]byte{msgFramebufferUpdate, 0})
+	}()
+	start := time.Now()
+	if _, err := c.Capture(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Capture() from a stalled server = %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Capture() from a stalled server took %v", elapsed)
+	}
+
+	// The stream is now out of step, so later captures must not read it
+	if _, err := c.Capture(); err == nil || !strings.Contains(err.Error(), "unusable") {
+		t.Errorf("Capture() after a timeout = %v, want the earlier error", err)
+	}
+	if err := c.KeyTap("right"); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("KeyTap() to a server that doesn't read = %v, want a deadline error", err)
+	}
+}
+
+// rectHeader is the header of one rectangle of a FramebufferUpdate.
+func rectHeader(r image.Rectangle, encoding int32) []byte {
+	var msg []byte
+	for _, v := range []int{r.Min.X, r.Min.Y, r.Dx(), r.Dy()} {
+		msg = binary.BigEndian.AppendUint16(msg, uint16(v))
+	}
+	return binary.BigEndian.AppendUint32(msg, uint32(encoding))
+}
+
+func TestCopyRect(t *testing.T) {
+	s := fakeServer{version: "003.008", security: securityNone, width: 6, height: 5}
+	c, server, err := connect(t, s, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Timeout = 2 * time.Second
+
+	// Every pixel of the first update is distinct; then copies, one onto
+	// itself shifted down and right, one shifted up and left, and a plain
+	// one, each applied to the result of the one before
+	screen := image.Rect(0, 0, s.width, s.height)
+	copies := []struct {
+		dst  image.Rectangle
+		from image.Point
+	}{
+		{image.Rect(1, 1, 5, 4), image.Pt(0, 0)},
+		{image.Rect(0, 0, 3, 3), image.Pt(2, 1)},
+		{image.Rect(4, 3, 6, 5), image.Pt(0, 3)},
+	}
+
+	want := image.NewRGBA(screen)
+	first := []byte{msgFramebufferUpdate, 0, 0, 1}
+	first = append(first, rectHeader(screen, encodingRaw)...)
+	for y := 0; y < s.height; y++ {
+		for x := 0; x < s.width; x++ {
+			pixel := []byte{uint8(x), uint8(y), uint8(10*y + x), 0}
+			first = append(first, pixel...)
+			copy(want.Pix[want.PixOffset(x, y):], []byte{pixel[0], pixel[1], pixel[2], 255})
+		}
+	}
+
+	second := []byte{msgFramebufferUpdate, 0, 0, uint8(len(copies))}
+	for _, cp := range copies {
+		second = append(second, rectHeader(cp.dst, encodingCopyRect)...)
+		second = binary.BigEndian.AppendUint16(second, uint16(cp.from.X))
+		second = binary.BigEndian.AppendUint16(second, uint16(cp.from.Y))
+
+		// Pixel by pixel from a snapshot, so overlap can't matter
+		before := image.NewRGBA(screen)
+		copy(before.Pix, want.Pix)
+		for y := 0; y < cp.dst.Dy(); y++ {
+			for x := 0; x < cp.dst.Dx(); x++ {
+				want.Set(cp.dst.Min.X+x, cp.dst.Min.Y+y, before.At(cp.from.X+x, cp.from.Y+y))
+			}
+		}
+	}
+
+	var img *image.RGBA
+	for _, update := range [][]byte{first, second} {
+		go func() {
+			var req [10]byte
+			if _, err := io.ReadFull(server, req[:]); err == nil {
+				server.Write(update)
+			}
+		}()
+		frame, err := c.Capture()
+		if err != nil {
+			t.Fatalf("Capture() = %v", err)
+		}
+		img = frame.Image
+	}
+
+	for y := 0; y < s.height; y++ {
+		for x := 0; x < s.width; x++ {
+			if got, w := img.RGBAAt(x, y), want.RGBAAt(x, y); got != w {
+				t.Errorf("pixel (%d,%d) = %v, want %v", x, y, got, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package window
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+)
+
+// Insets trim window chrome (title bar, toolbar, progress footer) off the
+// captured region. They are pixel distances from each window edge, so they
+// stay correct when the window is resized.
+type Insets struct {
+	Top    int `json:"top"`
+	Right  int `json:"right"`
+	Bottom int `json:"bottom"`
+	Left   int `json:"left"`
+}
+
+// InsetsBetween computes the insets that reduce window to content.
+func InsetsBetween(window, content image.Rectangle) (Insets, error) {
+	if !content.In(window) || content.Empty() {
+		return Insets{}, fmt.Errorf("content %v is not inside window %v", content, window)
+	}
+	return Insets{
+		Top:    content.Min.Y - window.Min.Y,
+		Right:  window.Max.X - content.Max.X,
+		Bottom: window.Max.Y - content.Max.Y,
+		Left:   content.Min.X - window.Min.X,
+	}, nil
+}
+
+// Apply shrinks r by the insets. If the window has become too small for
+// them, r is returned unchanged.
+func (in Insets) Apply(r image.Rectangle) image.Rectangle {
+	// image.Rect would swap inverted coordinates, so build it directly
+	content := image.Rectangle{
+		Min: image.Pt(r.Min.X+in.Left, r.Min.Y+in.Top),
+		Max: image.Pt(r.Max.X-in.Right, r.Max.Y-in.Bottom),
+	}
+	if content.Empty() {
+		return r
+	}
+	return content
+}
+
+// LoadCalibration reads the insets saved for profile. A missing file or
+// profile yields zero insets.
+func LoadCalibration(path, profile string) (Insets, error) {
+	all, err := readCalibrations(path)
+	if err != nil {
+		return Insets{}, err
+	}
+	return all[profile], nil
+}
+
+// SaveCalibration stores the insets for profile, keeping other profiles'.
+func SaveCalibration(path, profile string, in Insets) error {
+	all, err := readCalibrations(path)
+	if err != nil {
+		return err
+	}
+	all[profile] = in
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to save calibration: %w", err)
+	}
+	return nil
+}
+
+func readCalibrations(path string) (map[string]Insets, error) {
+	all := map[string]Insets{}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read calibration: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("invalid calibration file %s: %w", path, err)
+	}
+	return all, nil
+}
@@ -0,0 +1,60 @@
+package window
+
+import (
+	"image"
+	"testing"
+)
+
+func TestInsets(t *testing.T) {
+	win := image.Rect(100, 50, 900, 650)
+	content := image.Rect(110, 100, 880, 620)
+
+	in, err := InsetsBetween(win, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Insets{Top: 50, Right: 20, Bottom: 30, Left: 10}); in != want {
+		t.Errorf("InsetsBetween = %+v, want %+v", in, want)
+	}
+
+	// Insets follow the window when it moves or grows
+	moved := win.Add(image.Pt(40, 40))
+	if got, want := in.Apply(moved), content.Add(image.Pt(40, 40)); got != want {
+		t.Errorf("Apply(%v) = %v, want %v", moved, got, want)
+	}
+
+	// A window too small for the insets is left whole
+	tiny := image.Rect(0, 0, 20, 20)
+	if got := in.Apply(tiny); got != tiny {
+		t.Errorf("Apply(%v) = %v, want it unchanged", tiny, got)
+	}
+
+	if _, err := InsetsBetween(win, image.Rect(0, 0, 200, 200)); err == nil {
+		t.Error("InsetsBetween accepted content outside the window")
+	}
+}
+
+func TestCalibration(t *testing.T) {
+	path := t.TempDir() + "/calibration.json"
+
+	in, err := LoadCalibration(path, "kindle")
+	if err != nil || in != (Insets{}) {
+		t.Fatalf("LoadCalibration without a file = %+v, %v, want zero insets", in, err)
+	}
+
+	kindle := Insets{Top: 40, Bottom: 30}
+	books := Insets{Top: 52, Left: 8}
+	if err := SaveCalibration(path, "kindle", kindle); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveCalibration(path, "books", books); err != nil {
+		t.Fatal(err)
+	}
+
+	for profile, want := range map[string]Insets{"kindle": kindle, "books": books, "calibre": {}} {
+		got, err := LoadCalibration(path, profile)
+		if err != nil || got != want {
+			t.Errorf("LoadCalibration(%s) = %+v, %v, want %+v", profile, got, err, want)
+		}
+	}
+}
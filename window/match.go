@@ -0,0 +1,110 @@
+package window
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Pick decides which window wins when several satisfy a Matcher.
+type Pick int
+
+const (
+	PickFrontmost Pick = iota
+	PickLargest
+	PickNth
+)
+
+// Matcher describes the target window. Every non-zero criterion must match.
+type Matcher struct {
+	Name      string         // Profile name, e.g. "kindle"; used as the file prefix
+	Owner     string         // Case-insensitive substring of the owner/WM_CLASS
+	Title     *regexp.Regexp // Pattern the window title must match
+	PID       int
+	MinWidth  int
+	MinHeight int
+	Pick      Pick
+	Nth       int // 1-based index into the matches (frontmost first) for PickNth
+}
+
+// Match reports whether w satisfies every criterion of the matcher.
+func (m Matcher) Match(w Info) bool {
+	if m.Owner != "" && !strings.Contains(strings.ToLower(w.Owner), strings.ToLower(m.Owner)) {
+		return false
+	}
+	if m.Title != nil && !m.Title.MatchString(w.Title) {
+		return false
+	}
+	if m.PID != 0 && w.PID != m.PID {
+		return false
+	}
+	if w.Bounds.Dx() < m.MinWidth || w.Bounds.Dy() < m.MinHeight {
+		return false
+	}
+	return true
+}
+
+// Select applies the matcher and its tie-break to a frontmost-first list.
+func (m Matcher) Select(windows []Info) (Info, error) {
+	var matches []Info
+	for _, w := range windows {
+		if m.Match(w) {
+			matches = append(matches, w)
+		}
+	}
+
+	if len(matches) == 0 {
+		return Info{}, ErrNotFound
+	}
+
+	switch m.Pick {
+	case PickLargest:
+		best := matches[0]
+		for _, w := range matches[1:] {
+			if w.Bounds.Dx()*w.Bounds.Dy() > best.Bounds.Dx()*best.Bounds.Dy() {
+				best = w
+			}
+		}
+		return best, nil
+	case PickNth:
+		if m.Nth < 1 || m.Nth > len(matches) {
+			return Info{}, fmt.Errorf("%w: only %d matching windows, wanted #%d", ErrNotFound, len(matches), m.Nth)
+		}
+		return matches[m.Nth-1], nil
+	default:
+		return matches[0], nil
+	}
+}
+
+// ParsePick parses a tie-break spec: "frontmost", "largest" or "nth:N".
+func ParsePick(spec string) (Pick, int, error) {
+	switch {
+	case spec == "" || spec == "frontmost":
+		return PickFrontmost, 0, nil
+	case spec == "largest":
+		return PickLargest, 0, nil
+	case strings.HasPrefix(spec, "nth:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(spec, "nth:"))
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid window index in %q", spec)
+		}
+		return PickNth, n, nil
+	}
+	return 0, 0, fmt.Errorf("unknown window pick %q (want frontmost, largest or nth:N)", spec)
+}
+
+// ParseSize parses a "WIDTHxHEIGHT" spec such as "800x600".
+func ParseSize(spec string) (int, int, error) {
+	if spec == "" {
+		return 0, 0, nil
+	}
+
+	w, h, ok := strings.Cut(spec, "x")
+	width, err1 := strconv.Atoi(w)
+	height, err2 := strconv.Atoi(h)
+	if !ok || err1 != nil || err2 != nil || width < 0 || height < 0 {
+		return 0, 0, fmt.Errorf("invalid size %q (want WIDTHxHEIGHT)", spec)
+	}
+	return width, height, nil
+}
@@ -0,0 +1,96 @@
+package window
+
+import (
+	"errors"
+	"image"
+	"regexp"
+	"testing"
+)
+
+// Frontmost first, as List returns them
+var testWindows = []Info{
+	{ID: 1, Owner: "kitty", Title: "~/books", PID: 10, Bounds: image.Rect(0, 0, 800, 600)},
+	{ID: 2, Owner: "Kindle", Title: "Kindle", PID: 20, Bounds: image.Rect(0, 0, 300, 200)},
+	{ID: 3, Owner: "Kindle", Title: "Dune", PID: 20, Bounds: image.Rect(0, 0, 1200, 900)},
+	{ID: 4, Owner: "Firefox", Title: "manual.pdf - Firefox", PID: 30, Bounds: image.Rect(0, 0, 1000, 800)},
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Matcher
+		want uint32 // 0 when no window should match
+	}{
+		{"any window", Matcher{}, 1},
+		{"owner, case-insensitive", Matcher{Owner: "kindle"}, 2},
+		{"owner substring", Matcher{Owner: "fox"}, 4},
+		{"title", Matcher{Title: regexp.MustCompile(`\.pdf\b`)}, 4},
+		{"owner and title", Matcher{Owner: "Kindle", Title: regexp.MustCompile("^Dune$")}, 3},
+		{"pid", Matcher{PID: 30}, 4},
+		{"min size", Matcher{Owner: "Kindle", MinWidth: 400, MinHeight: 300}, 3},
+		{"largest", Matcher{Owner: "Kindle", Pick: PickLargest}, 3},
+		{"nth", Matcher{Owner: "Kindle", Pick: PickNth, Nth: 2}, 3},
+		{"nth out of range", Matcher{Owner: "Kindle", Pick: PickNth, Nth: 3}, 0},
+		{"no match", Matcher{Owner: "Books"}, 0},
+		{"all criteria must match", Matcher{Owner: "Kindle", PID: 30}, 0},
+	}
+	for _, tt := range tests {
+		got, err := tt.m.Select(testWindows)
+		if tt.want == 0 {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s: Select = window %d, %v, want ErrNotFound", tt.name, got.ID, err)
+			}
+			continue
+		}
+		if err != nil || got.ID != tt.want {
+			t.Errorf("%s: Select = window %d, %v, want window %d", tt.name, got.ID, err, tt.want)
+		}
+	}
+}
+
+func TestParsePick(t *testing.T) {
+	tests := []struct {
+		spec string
+		pick Pick
+		nth  int
+		ok   bool
+	}{
+		{"", PickFrontmost, 0, true},
+		{"frontmost", PickFrontmost, 0, true},
+		{"largest", PickLargest, 0, true},
+		{"nth:1", PickNth, 1, true},
+		{"nth:12", PickNth, 12, true},
+		{"nth:0", 0, 0, false},
+		{"nth:x", 0, 0, false},
+		{"nth:", 0, 0, false},
+		{"biggest", 0, 0, false},
+	}
+	for _, tt := range tests {
+		pick, nth, err := ParsePick(tt.spec)
+		if (err == nil) != tt.ok || pick != tt.pick || nth != tt.nth {
+			t.Errorf("ParsePick(%q) = %v, %d, %v, want %v, %d, ok %v", tt.spec, pick, nth, err, tt.pick, tt.nth, tt.ok)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		spec string
+		w, h int
+		ok   bool
+	}{
+		{"", 0, 0, true},
+		{"800x600", 800, 600, true},
+		{"0x100", 0, 100, true},
+		{"800", 0, 0, false},
+		{"800x", 0, 0, false},
+		{"-1x600", 0, 0, false},
+		{"800X600", 0, 0, false},
+	}
+	for _, tt := range tests {
+		w, h, err := ParseSize(tt.spec)
+		if (err == nil) != tt.ok || w != tt.w || h != tt.h {
+			t.Errorf("ParseSize(%q) = %d, %d, %v, want %d, %d, ok %v", tt.spec, w, h, err, tt.w, tt.h, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// Package window locates on-screen application windows so the capture tool
+// can grab the reader window instead of the whole display.
+package window
+
+import (
+	"errors"
+	"image"
+)
+
+// ErrNotFound is returned when no window satisfies a Matcher.
+var ErrNotFound = errors.New("window not found")
+
+// Info describes a top-level window as reported by the platform.
+type Info struct {
+	ID     uint32
+	Owner  string // Application name (macOS owner name, X11 WM_CLASS class)
+	Title  string
+	PID    int
+	Bounds image.Rectangle
+}
+
+// List returns the visible top-level windows, frontmost first.
+func List() ([]Info, error) {
+	return list()
+}
+
+// Find lists the current windows and returns the one selected by m.
+func Find(m Matcher) (Info, error) {
+	windows, err := List()
+	if err != nil {
+		return Info{}, err
+	}
+	return m.Select(windows)
+}
@@ -0,0 +1,72 @@
+package window
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"os/exec"
+)
+
+// quartzScript prints every on-screen window as a JSON array. Python's Quartz
+// bindings are more reliable than AppleScript for apps like Kindle.
+const quartzScript = `
+import json
+import Quartz
+
+window_list = Quartz.CGWindowListCopyWindowInfo(
+    Quartz.kCGWindowListOptionOnScreenOnly | Quartz.kCGWindowListExcludeDesktopElements,
+    Quartz.kCGNullWindowID
+)
+
+windows = []
+for window in window_list:
+    bounds = window.get('kCGWindowBounds', {})
+    windows.append({
+        'id': int(window.get('kCGWindowNumber', 0)),
+        'owner': window.get('kCGWindowOwnerName', '') or '',
+        'title': window.get('kCGWindowName', '') or '',
+        'pid': int(window.get('kCGWindowOwnerPID', 0)),
+        'x': int(bounds.get('X', 0)),
+        'y': int(bounds.get('Y', 0)),
+        'width': int(bounds.get('Width', 0)),
+        'height': int(bounds.get('Height', 0)),
+    })
+print(json.dumps(windows))
+`
+
+type quartzWindow struct {
+	ID     uint32 `json:"id"`
+	Owner  string `json:"owner"`
+	Title  string `json:"title"`
+	PID    int    `json:"pid"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+func list() ([]Info, error) {
+	output, err := exec.Command("python3", "-c", quartzScript).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list windows: %w", err)
+	}
+
+	var raw []quartzWindow
+	if err := json.Unmarshal(output, &raw); err != nil {
+		return nil, fmt.Errorf("invalid window list output: %w", err)
+	}
+
+	// CGWindowListCopyWindowInfo already orders windows front to back
+	windows := make([]Info, 0, len(raw))
+	for _, w := range raw {
+		windows = append(windows, Info{
+			ID:     w.ID,
+			Owner:  w.Owner,
+			Title:  w.Title,
+			PID:    w.PID,
+			Bounds: image.Rect(w.X, w.Y, w.X+w.Width, w.Y+w.Height),
+		})
+	}
+
+	return windows, nil
+}
@@ -0,0 +1,12 @@
+//go:build !darwin && !linux && !freebsd && !netbsd && !openbsd
+
+package window
+
+import (
+	"errors"
+	"fmt"
+)
+
+func list() ([]Info, error) {
+	return nil, fmt.Errorf("window listing: %w", errors.ErrUnsupported)
+}
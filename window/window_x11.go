@@ -0,0 +1,138 @@
+//go:build linux || freebsd || netbsd || openbsd
+
+package window
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// x11 walks the window tree of the default screen. Window managers reparent
+// client windows into frames, so the walk descends until it reaches a window
+// carrying WM_CLASS, which is what the application itself created.
+type x11 struct {
+	conn      *xgb.Conn
+	root      xproto.Window
+	netWMName xproto.Atom
+	netWMPID  xproto.Atom
+}
+
+func list() ([]Info, error) {
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to X server: %w", err)
+	}
+	defer conn.Close()
+
+	x := &x11{
+		conn: conn,
+		root: xproto.Setup(conn).DefaultScreen(conn).Root,
+	}
+
+	if x.netWMName, err = x.atom("_NET_WM_NAME"); err != nil {
+		return nil, err
+	}
+	if x.netWMPID, err = x.atom("_NET_WM_PID"); err != nil {
+		return nil, err
+	}
+
+	var windows []Info
+	if err := x.walk(x.root, &windows); err != nil {
+		return nil, err
+	}
+
+	return windows, nil
+}
+
+func (x *x11) atom(name string) (xproto.Atom, error) {
+	reply, err := xproto.InternAtom(x.conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, fmt.Errorf("failed to intern atom %s: %w", name, err)
+	}
+	return reply.Atom, nil
+}
+
+func (x *x11) walk(parent xproto.Window, out *[]Info) error {
+	tree, err := xproto.QueryTree(x.conn, parent).Reply()
+	if err != nil {
+		return fmt.Errorf("failed to query window tree: %w", err)
+	}
+
+	// Children come back in bottom-to-top stacking order
+	for i := len(tree.Children) - 1; i >= 0; i-- {
+		child := tree.Children[i]
+
+		attrs, err := xproto.GetWindowAttributes(x.conn, child).Reply()
+		if err != nil || attrs.MapState != xproto.MapStateViewable || attrs.Class == xproto.WindowClassInputOnly {
+			continue
+		}
+
+		class := x.property(child, xproto.AtomWmClass)
+		if class == nil {
+			// Window manager frame, keep descending. Windows that vanish
+			// mid-walk are simply skipped.
+			x.walk(child, out)
+			continue
+		}
+
+		info, err := x.info(child, class)
+		if err != nil {
+			continue
+		}
+		*out = append(*out, info)
+	}
+
+	return nil
+}
+
+func (x *x11) info(win xproto.Window, class []byte) (Info, error) {
+	geom, err := xproto.GetGeometry(x.conn, xproto.Drawable(win)).Reply()
+	if err != nil {
+		return Info{}, err
+	}
+
+	// Geometry is relative to the parent frame, translate to root coordinates
+	origin, err := xproto.TranslateCoordinates(x.conn, win, x.root, 0, 0).Reply()
+	if err != nil {
+		return Info{}, err
+	}
+
+	// WM_CLASS holds "instance\0class\0"; the class is the application name
+	owner := ""
+	parts := strings.Split(strings.TrimRight(string(class), "\x00"), "\x00")
+	if len(parts) > 0 {
+		owner = parts[len(parts)-1]
+	}
+
+	title := string(x.property(win, x.netWMName))
+	if title == "" {
+		title = string(x.property(win, xproto.AtomWmName))
+	}
+
+	pid := 0
+	if value := x.property(win, x.netWMPID); len(value) >= 4 {
+		pid = int(xgb.Get32(value))
+	}
+
+	minX, minY := int(origin.DstX), int(origin.DstY)
+	return Info{
+		ID:     uint32(win),
+		Owner:  owner,
+		Title:  title,
+		PID:    pid,
+		Bounds: image.Rect(minX, minY, minX+int(geom.Width), minY+int(geom.Height)),
+	}, nil
+}
+
+// property returns the raw value of a window property, or nil if unset.
+func (x *x11) property(win xproto.Window, atom xproto.Atom) []byte {
+	reply, err := xproto.GetProperty(x.conn, false, win, atom, xproto.GetPropertyTypeAny, 0, 1<<16).Reply()
+	if err != nil || reply.ValueLen == 0 {
+		return nil
+	}
+	return reply.Value
+}
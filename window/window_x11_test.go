@@ -0,0 +1,55 @@
+//go:build linux || freebsd || netbsd || openbsd
+
+package window
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// TestListX11 needs an X server, e.g. "xvfb-run go test ./window".
+func TestListX11(t *testing.T) {
+	if os.Getenv("DISPLAY") == "" {
+		t.Skip("DISPLAY not set")
+	}
+	conn, err := xgb.NewConn()
+	if err != nil {
+		t.Skipf("no X server: %v", err)
+	}
+	defer conn.Close()
+
+	screen := xproto.Setup(conn).DefaultScreen(conn)
+	win, err := xproto.NewWindowId(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = xproto.CreateWindowChecked(conn, screen.RootDepth, win, screen.Root, 40, 30, 320, 240, 0,
+		xproto.WindowClassInputOutput, screen.RootVisual, 0, nil).Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer xproto.DestroyWindow(conn, win)
+
+	class := "kindle\x00Kindle\x00"
+	title := "Dune"
+	xproto.ChangeProperty(conn, xproto.PropModeReplace, win, xproto.AtomWmClass, xproto.AtomString, 8, uint32(len(class)), []byte(class))
+	xproto.ChangeProperty(conn, xproto.PropModeReplace, win, xproto.AtomWmName, xproto.AtomString, 8, uint32(len(title)), []byte(title))
+	if err := xproto.MapWindowChecked(conn, win).Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := Find(Matcher{Owner: "kindle"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != uint32(win) || info.Title != title {
+		t.Errorf("Find = window %d %q, want %d %q", info.ID, info.Title, win, title)
+	}
+	// Without a window manager the window stays where it was created
+	if info.Bounds.Dx() != 320 || info.Bounds.Dy() != 240 {
+		t.Errorf("bounds = %v, want 320x240", info.Bounds)
+	}
+}